@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 
 	"bitbucket.org/retirementplanio/simulation.retirementplan.io/simulation"
@@ -18,7 +19,7 @@ func main() {
 	// s := simulation.SimulationData{
 	// 	NumberOfTrials:        5000,
 	// 	CholeskyDecomposition: []float64{0.0094794922, 0, 0, -7.36e-05, 0.0055677999, 0, 0.0050681903, -0.0004821709, 0.013367741},
-	// 	Inflation:             simulation.Distribution{Mean: 0.00046346514957523, StdDev: 0.00024792742828969},
+	// 	Inflation:             simulation.InflationDistribution{Distribution: simulation.Distribution{Mean: 0.00046346514957523, StdDev: 0.00024792742828969}},
 	// 	RealEstate:            simulation.Distribution{Mean: 0.0029064094738571, StdDev: 0.014660011854061},
 	// 	AssetPerformanceData: map[string]simulation.Distribution{
 	// 		"INTL-BOND":      simulation.Distribution{Mean: 0.0003, StdDev: 0.0002},
@@ -43,7 +44,7 @@ func main() {
 	// s := simulation.SimulationData{
 	// 	NumberOfTrials:        1000,
 	// 	CholeskyDecomposition: []float64{0.0206140002, 0, 0, 0, 0.0058743434, 0.0107500299, 0, 0, 0.0012367294, 0.003156581, 0.0172708088, 0, 0.0086516523, 0.0062800071, 0.008154059, 0.0204417622},
-	// 	Inflation:             simulation.Distribution{Mean: 0.00141579416791443, StdDev: 0.00300832469830286},
+	// 	Inflation:             simulation.InflationDistribution{Distribution: simulation.Distribution{Mean: 0.00141579416791443, StdDev: 0.00300832469830286}},
 	// 	RealEstate:            simulation.Distribution{Mean: -0.00347709477116344, StdDev: 0.0097874440308587},
 	// 	AssetPerformanceData: map[string]simulation.Distribution{
 	// 		"INTL-REALESTATE":  simulation.Distribution{Mean: -0.0025180101, StdDev: 0.0608277917},
@@ -71,7 +72,7 @@ func main() {
 	s := simulation.SimulationData{
 		NumberOfTrials:        5,
 		CholeskyDecomposition: []float64{0.0576625891, 0, 0, 0, 0, 0.0062658019, 0.0175730542, 0, 0, 0, 0.0056351399, 0.0051007659, 0.0031372137, 0, 0, -0.0046404388, 0.0058461108, 0.0015728539, 0.005015221, 0, 0.054254316, -0.0004589824, 0.0001774192, 0.0012348558, 0.0121795492},
-		Inflation:             simulation.Distribution{Mean: 0.001387958865714121, StdDev: 0.002999574074911733},
+		Inflation:             simulation.InflationDistribution{Distribution: simulation.Distribution{Mean: 0.001387958865714121, StdDev: 0.002999574074911733}},
 		RealEstate:            simulation.Distribution{Mean: -0.003477094771163442, StdDev: 0.009787444030858702},
 		AssetPerformanceData: map[string]simulation.Distribution{
 			"US-MED-GOV-BOND":  simulation.Distribution{Mean: 0.0064879833, StdDev: 0.0136574658},
@@ -96,6 +97,9 @@ func main() {
 		SelectedPortfolioWeights: map[string]float64{"CDN-LONG-BOND": 0, "INTL-BOND": 0.491, "US-MED-CORP-BOND": 0.1608, "US-MED-GOV-BOND": 0.3483, "US-SMCAP-STOCK": 0},
 	}
 
-	results := simulation.Simulate(&s)
-	fmt.Printf("Length of results: %d\n", len(results))
+	results, err := simulation.Simulate(context.Background(), &s, simulation.DefaultLimits())
+	if err != nil {
+		panic(err)
+	}
+	fmt.Printf("Length of results: %d\n", len(results.Timesteps))
 }
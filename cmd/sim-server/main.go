@@ -5,7 +5,6 @@ import (
 	"flag"
 	"fmt"
 	"log"
-	"math/rand"
 	"net/http"
 	"os"
 	"runtime"
@@ -16,6 +15,17 @@ import (
 	"github.com/zenazn/goji/web"
 )
 
+///////////
+// Flags //
+///////////
+
+var (
+	workers     = flag.Int("workers", 0, "Number of goroutines used to run simulation trials (0 for GOMAXPROCS)")
+	maxTrials   = flag.Int("max-trials", 10000, "Maximum number_of_trials a single request may ask for (0 for no limit)")
+	maxDuration = flag.Duration("max-duration", 25*time.Second, "Maximum time a single request may simulate for (0 for no limit)")
+	history     = flag.String("return-history", "", "CSV of historical monthly returns used by the bootstrap return model when a request has none")
+)
+
 //////////
 // Main //
 //////////
@@ -23,14 +33,18 @@ import (
 func main() {
 	runtime.GOMAXPROCS(runtime.NumCPU())
 
-	rand.Seed(time.Now().UnixNano())
-
 	port := os.Getenv("PORT")
 
 	if port != "" {
 		flag.Set("bind", ":"+port)
 	}
 
+	// goji.Serve() parses the flags, but the history must be loaded first.
+	flag.Parse()
+	if *history != "" {
+		loadReturnHistory(*history)
+	}
+
 	goji.Get("/", root)
 	goji.Get("/health", health)
 
@@ -86,7 +100,12 @@ func simulateHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
 	start := time.Now()
-	apiResponse := simulation.ValidateAndHandleJsonInput(r.Body)
+	limits := simulation.Limits{
+		Workers:     *workers,
+		MaxTrials:   *maxTrials,
+		MaxDuration: *maxDuration,
+	}
+	apiResponse := simulation.ValidateAndHandleJsonInput(r.Context(), r.Body, limits)
 	end := time.Since(start)
 
 	log.Printf("Processed request from %s in %vs", r.RemoteAddr, end)
@@ -100,6 +119,21 @@ func simulateHandler(w http.ResponseWriter, r *http.Request) {
 // Utilities //
 ///////////////
 
+func loadReturnHistory(path string) {
+	f, err := os.Open(path)
+	if err != nil {
+		log.Fatalln("Could not open return history:", err)
+	}
+	defer f.Close()
+
+	h, err := simulation.LoadReturnHistoryCSV(f)
+	if err != nil {
+		log.Fatalln("Could not load return history:", err)
+	}
+	simulation.SetDefaultReturnHistory(h)
+	log.Printf("Loaded %d months of return history from %s", len(h.Inflation), path)
+}
+
 type response map[string]interface{}
 
 func (r response) String() (s string) {
@@ -0,0 +1,234 @@
+package simulation
+
+// Tax treatments an account can have
+const (
+	taxable     = "taxable"      // non-registered - withdrawals are not taxed again
+	taxDeferred = "tax_deferred" // RRSP / 401k - contributions are pre-tax, withdrawals are taxed
+	taxFree     = "tax_free"     // TFSA / Roth - contributions are after-tax, withdrawals are not taxed
+)
+
+// Account is a single investment account. If no accounts are provided, the
+// simulation uses one taxable account holding the starting assets, invested in
+// the selected portfolio.
+type Account struct {
+	Id           string  `json:"id"`
+	Balance      float64 `json:"balance"`
+	TaxTreatment string  `json:"tax_treatment"` // "taxable", "tax_deferred" or "tax_free"
+
+	// Defaults to the selected portfolio. Asset classes must be ones in the
+	// selected portfolio, as that is what returns are generated for (a weight
+	// of 0 there includes an asset class without holding it).
+	PortfolioWeights map[string]float64 `json:"portfolio_weights"`
+
+	// Same format as expenses. Contributions are paid out of income, and
+	// contributions to tax-deferred accounts are made before tax.
+	Contributions []Expense `json:"contributions"`
+}
+
+// isTaxDeferred Determines if withdrawals from an Account are taxed
+// Receiver: Account
+// Params: None
+// Returns: bool
+func (a *Account) isTaxDeferred() bool {
+	return a.TaxTreatment == taxDeferred
+}
+
+// accounts returns the accounts to simulate - the provided accounts, or a
+// single taxable account holding the starting assets.
+// Receiver: SimulationData
+// Params: None
+// Returns: []Account
+func (s *SimulationData) accounts() []Account {
+	if len(s.Accounts) > 0 {
+		return s.Accounts
+	}
+	return []Account{{
+		Balance:      s.Parameters.StartingAssets,
+		TaxTreatment: taxable,
+	}}
+}
+
+// portfolioWeights returns the account's portfolio weights, or the selected
+// portfolio if it doesn't have its own.
+// Receiver: Account
+// Params: s *SimulationData
+// Returns: map[string]float64
+func (a *Account) portfolioWeights(s *SimulationData) map[string]float64 {
+	if len(a.PortfolioWeights) > 0 {
+		return a.PortfolioWeights
+	}
+	return s.SelectedPortfolioWeights
+}
+
+// usesGlidePath Determines if the account's weights follow the glide path -
+// i.e. there is one, and the account doesn't have its own weights.
+// Receiver: Account
+// Params: s *SimulationData
+// Returns: bool
+func (a *Account) usesGlidePath(s *SimulationData) bool {
+	return s.GlidePath.enabled() && len(a.PortfolioWeights) == 0
+}
+
+// depositAccountIndex picks the account surplus cash flow is saved into - the
+// first taxable account, or the first account if there are none.
+// Params: accounts []Account
+// Returns: int
+func depositAccountIndex(accounts []Account) int {
+	for i, account := range accounts {
+		if account.TaxTreatment == taxable {
+			return i
+		}
+	}
+	return 0
+}
+
+// applyCashFlows runs through the timeSteps, growing each account by its own
+// portfolio's returns, paying in contributions, and saving any excess income or
+// withdrawing to cover any shortfall (including debt payments) using the
+// chosen withdrawal strategy. Once
+// retired, expenses are replaced by the spending policy's, if there is one.
+// Accounts are rebalanced according to the rebalancing policy. Sets the assets
+// (and per-account balances and withdrawals, if accounts were provided) for
+// each time step.
+// Receiver: SimulationData
+// Params: trialResult []simulationTimeStep -- income and expenses already applied
+// Params: timeSteps []*timeStep -- contributions schedule
+// Params: assetPerformance MarketPath
+// Returns: None
+func (s *SimulationData) applyCashFlows(trialResult []simulationTimeStep, timeSteps []*timeStep, assetPerformance MarketPath) {
+	accounts := s.accounts()
+	balances := make([]float64, len(accounts))
+	returns := make([]returnsList, len(accounts))
+	var portfolios []*holdings // by account, if weights can drift
+	if s.Rebalancing.tracksHoldings() {
+		portfolios = make([]*holdings, len(accounts))
+	}
+	var expenseRatios []returnsList // by account, if not tracking holdings
+	var assetExpenseRatios returnResultsByAsset
+	if portfolios == nil && len(s.Fees.ExpenseRatios) > 0 {
+		expenseRatios = make([]returnsList, len(accounts))
+		assetExpenseRatios = s.monthlyExpenseRatios(len(trialResult))
+	}
+	for i := range accounts {
+		balances[i] = accounts[i].Balance
+		switch {
+		case portfolios != nil:
+			portfolios[i] = s.newHoldings(&accounts[i], assetPerformance.Assets, balances[i])
+		case accounts[i].usesGlidePath(s):
+			returns[i] = s.glidePathPerformance(assetPerformance.Assets, len(trialResult))
+			if expenseRatios != nil {
+				expenseRatios[i] = s.glidePathPerformance(assetExpenseRatios, len(trialResult))
+			}
+		default:
+			returns[i] = s.generatePortfolioPerformance(assetPerformance.Assets, accounts[i].portfolioWeights(s), len(trialResult))
+			if expenseRatios != nil {
+				expenseRatios[i] = s.generatePortfolioPerformance(assetExpenseRatios, accounts[i].portfolioWeights(s), len(trialResult))
+			}
+		}
+	}
+	feesPaid := 0.0
+	strategy := withdrawalStrategies[s.WithdrawalStrategy.name()]
+	w := &withdrawal{
+		accounts:       accounts,
+		balances:       balances,
+		depositAccount: depositAccountIndex(accounts),
+		bracketCeiling: s.WithdrawalStrategy.BracketCeiling,
+	}
+	unreportedDraws := make([]float64, len(accounts)) // scratch space, not reported
+	spending := s.newSpendingState()
+
+	for monthIndex := range trialResult {
+		step := &trialResult[monthIndex]
+
+		step.assets = 0
+		for _, balance := range balances {
+			step.assets += balance
+		}
+		if len(s.Accounts) > 0 {
+			step.accountBalances = append([]float64(nil), balances...)
+			w.draws = make([]float64, len(balances))
+			step.accountWithdrawals = w.draws
+		} else {
+			w.draws = unreportedDraws
+		}
+
+		someoneAlive := step.maleAlive || step.femaleAlive
+		if spending != nil && someoneAlive && s.householdRetired(step) {
+			// Spend income plus whatever the policy allows from the portfolio
+			step.expenses = step.income + spending.monthlyWithdrawal(step, monthIndex, step.assets)
+		}
+
+		for i := range balances {
+			var gains float64
+			if portfolios != nil {
+				gains = portfolios[i].grow(monthIndex)
+			} else {
+				gains = balances[i] * returns[i][monthIndex]
+			}
+			balances[i] += gains
+			if spending != nil {
+				spending.recordGains(gains)
+			}
+		}
+		if s.Fees.enabled() {
+			fees := s.chargeFees(balances, portfolios, expenseRatios, monthIndex)
+			if spending != nil {
+				spending.recordGains(-fees) // gains are net of fees
+			}
+			feesPaid += fees
+			step.fees = feesPaid
+		}
+
+		taxRate := s.withdrawalTaxRate(step)
+		w.taxRate = taxRate
+		netCashFlow := step.income - step.expenses - step.debtPayments + step.inflows
+		for i, contribution := range timeSteps[monthIndex].contributions {
+			if !someoneAlive {
+				break
+			}
+			balances[i] += contribution
+			if accounts[i].isTaxDeferred() {
+				// Made from pre-tax income, so only costs the after-tax amount
+				netCashFlow -= contribution * (1 - taxRate)
+			} else {
+				netCashFlow -= contribution
+			}
+		}
+
+		w.deferredDraws = 0
+		if netCashFlow >= 0 {
+			balances[w.depositAccount] += netCashFlow
+		} else {
+			w.step = step
+			strategy(w, -netCashFlow)
+		}
+
+		// Tax was withheld from tax-deferred withdrawals at the marginal rate.
+		// With brackets the withdrawals may have pushed income into a higher
+		// one - settle the difference with the deposit account.
+		withheld := w.deferredDraws * taxRate
+		withdrawalTax := withheld
+		if s.Tax.enabled() && w.deferredDraws > 0 {
+			withdrawalTax = s.Tax.monthlyTax(s, step, w.deferredDraws) - step.taxes
+			balances[w.depositAccount] -= withdrawalTax - withheld
+		}
+		step.taxes += withdrawalTax
+
+		for i, portfolio := range portfolios {
+			balances[i] = portfolio.settle(balances[i], &s.Rebalancing, monthIndex)
+		}
+	}
+}
+
+// withdrawalTaxRate returns the rate tax is withheld from tax-deferred
+// withdrawals (and saved on contributions) at in a time step - the flat rate,
+// or the marginal rate if using tax brackets.
+// Receiver: SimulationData
+// Params: step *simulationTimeStep
+// Returns: float64 -- 0 - 1
+func (s *SimulationData) withdrawalTaxRate(step *simulationTimeStep) float64 {
+	if s.Tax.enabled() {
+		return s.Tax.withdrawalRate(s, step)
+	}
+	return s.flatTaxRate(step) / 100
+}
@@ -0,0 +1,66 @@
+package simulation
+
+import (
+	"context"
+	"testing"
+)
+
+func TestApplyCashFlowsContributionsAndSurplus(t *testing.T) {
+	s := &SimulationData{
+		Parameters: Parameters{Male: true, CurrentTax: 40, RetirementAgeMale: 65, MaleAge: 40},
+		Accounts: []Account{
+			Account{Id: "rrsp", Balance: 1000, TaxTreatment: taxDeferred},
+			Account{Id: "tfsa", Balance: 500, TaxTreatment: taxFree},
+			Account{Id: "cash", Balance: 0, TaxTreatment: taxable},
+		},
+		SelectedPortfolioWeights: map[string]float64{"BOND": 1},
+	}
+	trialResult := []simulationTimeStep{
+		simulationTimeStep{income: 1000, expenses: 200, maleAlive: true},
+		simulationTimeStep{income: 0, expenses: 0, maleAlive: true},
+	}
+	timeSteps := []*timeStep{
+		&timeStep{contributions: []float64{100, 50, 0}},
+		&timeStep{contributions: []float64{0, 0, 0}},
+	}
+	assetPerformance := MarketPath{Assets: returnResultsByAsset{"BOND": returnsList{0, 0}}}
+
+	s.applyCashFlows(trialResult, timeSteps, assetPerformance)
+
+	// 800 surplus, less 60 for the pre-tax RRSP contribution and 50 for the
+	// TFSA, saved in the taxable account
+	expected := []float64{1100, 550, 690}
+	for i, balance := range trialResult[1].accountBalances {
+		if !closeTo(balance, expected[i], 1e-9) {
+			t.Error("Account", i, "expected", expected[i], "got", balance)
+		}
+	}
+	if !closeTo(trialResult[1].assets, 2340, 1e-9) {
+		t.Error("Expected total assets of 2340, got", trialResult[1].assets)
+	}
+}
+
+func TestSimulateReportsAccounts(t *testing.T) {
+	s := validSimulationData()
+	s.Accounts = []Account{
+		Account{Id: "rrsp", Balance: 100000, TaxTreatment: taxDeferred, PortfolioWeights: map[string]float64{"INTL-BOND": 1}},
+		Account{Id: "cash", Balance: 25000, TaxTreatment: taxable},
+	}
+	results, err := Simulate(context.Background(), s, DefaultLimits())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first := results.Timesteps[0]
+	if first.Accounts["rrsp"].Balance.Mean != 100000 || first.Accounts["cash"].Balance.Mean != 25000 {
+		t.Error("Expected starting balances, got", first.Accounts)
+	}
+	if first.AssetsMean != 125000 {
+		t.Error("Expected assets to be the total of the accounts, got", first.AssetsMean)
+	}
+
+	results, _ = Simulate(context.Background(), validSimulationData(), DefaultLimits())
+	if results.Timesteps[0].Accounts != nil {
+		t.Error("Expected no accounts unless provided")
+	}
+}
@@ -22,36 +22,26 @@ import (
 	..
 */
 
-type assetPerformanceResults struct {
-	realEstatePerformance returnsList
-	inflationPerformance  returnsList
-	portfolioPerformance  returnsList
+// MarketPath is the monthly returns for a single trial
+type MarketPath struct {
+	RealEstate returnsList
+	Inflation  returnsList
+	Assets     returnResultsByAsset // by asset class - each account has its own portfolio
+	Regimes    []int                // regime_switching - the regime each month was in
 }
 
 type returnResultsByAsset map[string]returnsList
 
 type returnsList []float64
 
-// generateAssetPerformance generates performance results for real estate,
-// inflation and the overall portfolio, and returns as a struct of float arrays.
-// Receiver: SimulationData
-// Params: numberOfMonths int -- number of periods to model
-// Returns: assetPerformanceResults
-func (s *SimulationData) generateAssetPerformance(numberOfMonths int) assetPerformanceResults {
-	return assetPerformanceResults{
-		realEstatePerformance: s.realEstateRandoms(numberOfMonths),
-		inflationPerformance:  s.inflationRandoms(numberOfMonths),
-		portfolioPerformance:  s.generatePortfolioPerformance(numberOfMonths),
-	}
-}
-
 // generatePortfolioPerformance Consolidates the asset-level data into a single
-// value for the user's selected portfolio.
+// value for a portfolio.
 // Receiver: SimulationData
+// Params: assetPerformance returnResultsByAsset -- returns by asset class
+// Params: portfolioWeights map[string]float64 -- weight of each asset class
 // Params: numberOfMonths int -- number of periods to model
 // Returns: returnsList ([]float64)
-func (s *SimulationData) generatePortfolioPerformance(numberOfMonths int) returnsList {
-	assetPerformance := s.generateReturns(numberOfMonths)
+func (s *SimulationData) generatePortfolioPerformance(assetPerformance returnResultsByAsset, portfolioWeights map[string]float64, numberOfMonths int) returnsList {
 	/* assetPerformance is of the following form:
 		{
 	    	"CDN-REALESTATE": {0.00046232370381282806, 0.0003000276461659901, 0.00039978092717385394},
@@ -60,7 +50,6 @@ func (s *SimulationData) generatePortfolioPerformance(numberOfMonths int) return
 		}
 	*/
 
-	portfolioWeights := s.SelectedPortfolioWeights
 	/* portfolioWeights is of the following form:
 	{
 		"INTL-BOND":0.65,
@@ -69,26 +58,18 @@ func (s *SimulationData) generatePortfolioPerformance(numberOfMonths int) return
 	}
 	*/
 
-	// weightedReturns will be a map[string][]float64 where the keys are the
-	// security ID's, and the values will be an array of the weighted returns
-	// in each period.
-	weightedReturns := returnResultsByAsset{}
-	for securityId, portfolioWeightOfAsset := range portfolioWeights {
-		for _, periodReturn := range assetPerformance[securityId] {
-			weightedReturns[securityId] = append(weightedReturns[securityId], periodReturn*portfolioWeightOfAsset)
-		}
-	}
-
-	// Combine the weightedReturns into a portfolio return in each period this
-	// is a straight sum as we have already weighted the asset returns by
-	// portfolio weight.
+	// Weight each asset's return and sum into a portfolio return in each
+	// period. Sum in a fixed (sorted) order - map iteration order is random,
+	// and floating point addition is not associative.
 	portfolioReturns := make(returnsList, numberOfMonths)
-	for periodIndex := 0; periodIndex < numberOfMonths; periodIndex++ {
-		sum := 0.0
-		for _, periodReturns := range weightedReturns {
-			sum += periodReturns[periodIndex]
+	for _, securityId := range s.assetClassIds() {
+		portfolioWeightOfAsset, ok := portfolioWeights[securityId]
+		if !ok {
+			continue // not held in this portfolio
+		}
+		for periodIndex, periodReturn := range assetPerformance[securityId][:numberOfMonths] {
+			portfolioReturns[periodIndex] += periodReturn * portfolioWeightOfAsset
 		}
-		portfolioReturns[periodIndex] = sum
 	}
 
 	return portfolioReturns
@@ -98,14 +79,13 @@ func (s *SimulationData) generatePortfolioPerformance(numberOfMonths int) return
 // separately by asset class as a map
 // Receiver: SimulationData
 // Params: numberOfMonths int -- number of periods to model
+// Params: choleskyApplied *goMatrix.DenseMatrix -- correlated shocks, a column per asset class
 // Returns: returnResultsByAsset
-func (s *SimulationData) generateReturns(numberOfMonths int) returnResultsByAsset {
+func (s *SimulationData) generateReturns(numberOfMonths int, choleskyApplied *goMatrix.DenseMatrix) returnResultsByAsset {
 	assetPerformanceData := s.AssetPerformanceData // map[string]Distribution
 	assetClassIds := s.assetClassIds()             // []string
 	numberOfAssets := len(assetClassIds)
 
-	choleskyApplied := s.applyCholeskyDecomposition(numberOfMonths)
-
 	prices := goMatrix.Zeros(numberOfMonths, numberOfAssets)
 
 	for row := 0; row < prices.Rows(); row++ {
@@ -179,34 +159,26 @@ func (s *SimulationData) generateReturns(numberOfMonths int) returnResultsByAsse
 	return resultsByAsset
 }
 
-// choleskyMatrix takes the array of floats provided by the JSON data, and
-// converts it to a matrix.
+// choleskyMatrix takes the array of floats provided by the JSON data (or
+// decomposed from the correlation matrix), and converts it to a matrix.
 // Receiver: SimulationData
 // Params: none
 // Returns: *goMatrix.DenseMatrix
 func (s *SimulationData) choleskyMatrix() *goMatrix.DenseMatrix {
-	vals := s.CholeskyDecomposition
+	vals := s.choleskyValues()
 	noOfVals := float64(len(vals))
 	noRows := int(math.Pow(noOfVals, 0.5))
 	return goMatrix.MakeDenseMatrix(vals, noRows, noRows)
 }
 
-// inflationRandoms generates random inflation performance of a given length
-// based on the statistics in the SimulationData struct
-// Receiver: SimulationData
-// Params: numberOfMonths int -- number of periods to generate performance for
-// Returns: returnsList
-func (s *SimulationData) inflationRandoms(numberOfMonths int) returnsList {
-	return generateRandomsFromDistribution(s.Inflation, numberOfMonths)
-}
-
 // realEstateRandoms generates random real estate performance of a given length
 // based on the statistics in the SimulationData struct
 // Receiver: SimulationData
 // Params: numberOfMonths int -- number of periods to generate performance for
+// Params: rng *rand.Rand -- the trial's random stream
 // Returns: returnsList
-func (s *SimulationData) realEstateRandoms(numberOfMonths int) returnsList {
-	return generateRandomsFromDistribution(s.RealEstate, numberOfMonths)
+func (s *SimulationData) realEstateRandoms(numberOfMonths int, rng *rand.Rand) returnsList {
+	return generateRandomsFromDistribution(rng, s.RealEstate, numberOfMonths)
 }
 
 // applyCholeskyDecomposition returns a matrix with an applied cholesky
@@ -215,29 +187,38 @@ func (s *SimulationData) realEstateRandoms(numberOfMonths int) returnsList {
 // decomposition matrix size.
 // Receiver: SimulationData
 // Params: numberOfMonths int -- number of periods to generate performance for
+// Params: rng *rand.Rand -- the trial's random stream
 // Returns: *goMatrix.DenseMatrix
-func (s *SimulationData) applyCholeskyDecomposition(numberOfMonths int) *goMatrix.DenseMatrix {
+func (s *SimulationData) applyCholeskyDecomposition(numberOfMonths int, rng *rand.Rand) *goMatrix.DenseMatrix {
 	choleskyDecomposition := s.choleskyMatrix()
 	numberOfAssets := choleskyDecomposition.Cols()
-	randomValueMatrix := randomNormalsMatrix(numberOfMonths, numberOfAssets)
+	randomValueMatrix := s.randomShocksMatrix(rng, numberOfMonths, numberOfAssets)
 	choleskyApplied := zerosMatrix(numberOfMonths, numberOfAssets)
 
-	for row := 0; row < choleskyApplied.Rows(); row++ {
-		for column := 0; column < choleskyApplied.Cols(); column++ {
-			answer := 0.0
-			if column == 0 {
-				answer = randomValueMatrix.Get(row, 0)
-			} else {
-				for i := 0; i < column; i++ {
-					answer += randomValueMatrix.Get(row, i) * choleskyDecomposition.Get(column, i)
-				}
-			}
-			choleskyApplied.Set(row, column, answer)
-		}
+	shocks := randomValueMatrix.Arrays() // rows reference the matrices' data
+	correlated := choleskyApplied.Arrays()
+	for row := range correlated {
+		correlateShocks(choleskyDecomposition, shocks[row], correlated[row])
 	}
 	return choleskyApplied
 }
 
+// correlateShocks applies the cholesky matrix to a single period's shocks
+// Params: choleskyDecomposition *goMatrix.DenseMatrix
+// Params: shocks []float64 -- independent, one per asset
+// Params: correlated []float64 -- filled with the correlated shocks
+// Returns: None
+func correlateShocks(choleskyDecomposition *goMatrix.DenseMatrix, shocks, correlated []float64) {
+	for column := range correlated {
+		answer := 0.0
+		// Lower triangular, including the diagonal - each column's own shock
+		for i := 0; i <= column; i++ {
+			answer += shocks[i] * choleskyDecomposition.Get(column, i)
+		}
+		correlated[column] = answer
+	}
+}
+
 // assetClassIds returns the asset class IDs of interest - those that the user
 // has invested in.
 // Receiver: SimulationData
@@ -257,25 +238,48 @@ func (s *SimulationData) assetClassIds() []string {
 }
 
 // generateRandomsFromDistribution is a utility method that will generate a set
-// of random values from a given normal distribution
+// of random values from a given distribution
+// Params: rng *rand.Rand -- the trial's random stream
 // Params: distribution Distribution -- contains stats
 // Params: numberOfMonths int -- number of periods to generate randoms for
 // Returns: []float64
-func generateRandomsFromDistribution(distribution Distribution, numberOfMonths int) []float64 {
+func generateRandomsFromDistribution(rng *rand.Rand, distribution Distribution, numberOfMonths int) []float64 {
 	results := make([]float64, numberOfMonths)
 	for i := range results {
-		sample := rand.NormFloat64()*distribution.StdDev + distribution.Mean
+		sample := distribution.shock(rng)*distribution.StdDev + distribution.Mean
 		results[i] = sample
 	}
 	return results
 }
 
-// randomNormalsMatrix returns a matrix filled with random float64's of a given size
+// randomShocksMatrix returns a matrix of independent standardized shocks of a
+// given size, each column drawn from the shape of the matching asset class's
+// distribution (or inflation's, for a correlated inflation column). Filled by
+// hand rather than goMatrix.Normals, which draws from the global math/rand
+// source.
+// Receiver: SimulationData
+// Params: rng *rand.Rand -- the trial's random stream
 // Params: rows int -- number of rows to fill
 // Params: cols int -- number of cols to fill
 // Returns: *goMatrix.DenseMatrix
-func randomNormalsMatrix(rows, cols int) *goMatrix.DenseMatrix {
-	return goMatrix.Normals(rows, cols)
+func (s *SimulationData) randomShocksMatrix(rng *rand.Rand, rows, cols int) *goMatrix.DenseMatrix {
+	assetClassIds := s.assetClassIds()
+	distributions := make([]Distribution, cols)
+	for column := range distributions {
+		if column < len(assetClassIds) {
+			distributions[column] = s.AssetPerformanceData[assetClassIds[column]]
+		} else {
+			distributions[column] = s.Inflation.Distribution
+		}
+	}
+
+	shocks := goMatrix.Zeros(rows, cols)
+	for row := 0; row < rows; row++ {
+		for column := 0; column < cols; column++ {
+			shocks.Set(row, column, distributions[column].shock(rng))
+		}
+	}
+	return shocks
 }
 
 // zerosMatrix returns a matrix filled with zeroes of a given size
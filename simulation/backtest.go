@@ -0,0 +1,91 @@
+package simulation
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+// Simulation modes
+const (
+	monteCarloMode = "monte_carlo" // random trials (default)
+	backtestMode   = "backtest"    // replays history from every possible start month
+)
+
+// backtestResult is the outcome of replaying history from one start month
+type backtestResult struct {
+	Start          string  `json:"start"` // label of the first month replayed, e.g. "1929-01"
+	Failed         bool    `json:"failed"`
+	RuinAge        int     `json:"ruin_age,omitempty"` // age of the primary person when money ran out
+	TerminalWealth float64 `json:"terminal_wealth"`
+}
+
+// backtesting Determines if trials replay history rather than random returns
+// Receiver: SimulationData
+// Params: None
+// Returns: bool
+func (s *SimulationData) backtesting() bool {
+	return s.Mode == backtestMode
+}
+
+// backtestStarts returns how many start months the history has room for - one
+// trial each
+// Receiver: SimulationData
+// Params: numberOfMonths int -- months in each trial
+// Returns: int
+func (s *SimulationData) backtestStarts(numberOfMonths int) int {
+	history := s.returnHistory()
+	if history == nil || history.months() < numberOfMonths {
+		return 0
+	}
+	return history.months() - numberOfMonths + 1
+}
+
+// backtestLabel returns the label of a trial's first month
+// Receiver: SimulationData
+// Params: trial int
+// Returns: string
+func (s *SimulationData) backtestLabel(trial int) string {
+	history := s.returnHistory()
+	if trial < len(history.Months) {
+		return history.Months[trial]
+	}
+	return fmt.Sprintf("month %d", trial+1)
+}
+
+// marketPath returns a trial's returns - replayed from history when
+// backtesting, otherwise generated by the return model
+// Receiver: SimulationData
+// Params: trial int
+// Params: numberOfMonths int -- number of periods to model
+// Params: rng *rand.Rand -- the trial's random stream
+// Returns: MarketPath
+func (s *SimulationData) marketPath(trial, numberOfMonths int, rng *rand.Rand) MarketPath {
+	if !s.backtesting() {
+		return s.returnModel().Generate(s, numberOfMonths, rng)
+	}
+	return s.returnHistory().slice(s, trial, numberOfMonths)
+}
+
+// slice returns the history's returns from a start month, for the asset
+// classes in the selected portfolio
+// Receiver: ReturnHistory
+// Params: s *SimulationData
+// Params: start int -- first month
+// Params: numberOfMonths int
+// Returns: MarketPath
+func (h *ReturnHistory) slice(s *SimulationData, start, numberOfMonths int) MarketPath {
+	end := start + numberOfMonths
+	path := MarketPath{
+		Inflation: returnsList(h.Inflation[start:end]),
+		Assets:    returnResultsByAsset{},
+	}
+	if h.RealEstate != nil {
+		path.RealEstate = returnsList(h.RealEstate[start:end])
+	} else {
+		path.RealEstate = make(returnsList, numberOfMonths)
+	}
+	for _, assetClassId := range s.assetClassIds() {
+		path.Assets[assetClassId] = returnsList(h.Assets[assetClassId][start:end])
+	}
+	return path
+}
@@ -0,0 +1,101 @@
+package simulation
+
+import (
+	"context"
+	"testing"
+)
+
+// backtestSimulationData returns a 2 year backtest over 3 years of history
+// that loses 5% a month in its first year, and is flat after
+func backtestSimulationData() *SimulationData {
+	history := sequentialHistory(36)
+	history.Months = make([]string, 36)
+	for i := range history.Inflation {
+		history.Months[i] = "month " + string(rune('A'+i))
+		history.Inflation[i] = 0
+		history.RealEstate[i] = 0
+		for _, series := range history.Assets {
+			series[i] = 0
+			if i < 12 {
+				series[i] = -0.05
+			}
+		}
+	}
+
+	s := validSimulationData()
+	s.Mode = backtestMode
+	s.NumberOfTrials = 0
+	s.Horizon = Horizon{Type: "years", Value: 2}
+	s.Parameters.IncludeHome = false
+	s.Parameters.Retired = true
+	s.Parameters.RetirementAgeMale = 29
+	s.Parameters.RetirementAgeFemale = 30
+	s.Parameters.RetirementIncome = 0
+	s.Parameters.RetirementExpenses = 100
+	s.Expenses = []Expense{Expense{Amount: 4000, Frequency: "monthly"}}
+	s.ReturnModel.History = history
+	return s
+}
+
+func TestBacktestReplaysEveryStartMonth(t *testing.T) {
+	s := backtestSimulationData()
+	if errs := s.Validate(); len(errs) != 0 {
+		t.Fatal("Expected no errors, got", errs)
+	}
+	results, err := Simulate(context.Background(), s, DefaultLimits())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	backtests := results.Summary.Backtests
+	if len(backtests) != 13 {
+		t.Fatal("Expected a result for each of the 13 start months, got", len(backtests))
+	}
+	if backtests[0].Start != "month A" || backtests[12].Start != "month M" {
+		t.Error("Expected results labelled by start month, in order, got", backtests[0].Start, backtests[12].Start)
+	}
+	if !backtests[0].Failed || backtests[0].RuinAge == 0 {
+		t.Error("Expected starting in the crash to fail, got", backtests[0])
+	}
+	if backtests[12].Failed || backtests[12].TerminalWealth <= 0 {
+		t.Error("Expected starting after the crash to succeed, got", backtests[12])
+	}
+	if backtests[0].TerminalWealth >= backtests[12].TerminalWealth {
+		t.Error("Expected less left over after starting in the crash")
+	}
+
+	again, _ := Simulate(context.Background(), backtestSimulationData(), DefaultLimits())
+	if again.Summary.ProbabilityOfSuccess != results.Summary.ProbabilityOfSuccess {
+		t.Error("Expected backtests to be deterministic")
+	}
+}
+
+func TestBacktestLabelsDefaultToMonthNumbers(t *testing.T) {
+	s := backtestSimulationData()
+	s.ReturnModel.History.Months = nil
+	if label := s.backtestLabel(4); label != "month 5" {
+		t.Error("Expected a month number, got", label)
+	}
+}
+
+func TestValidateBacktest(t *testing.T) {
+	s := backtestSimulationData()
+	s.Horizon.Value = 4
+	s.ReturnModel.History.Months = s.ReturnModel.History.Months[:3]
+	errs := s.Validate()
+	if !hasValidationError(errs, "return_model.history", errCodeOutOfRange) {
+		t.Error("Expected a history shorter than the horizon to be invalid, got", errs)
+	}
+	if !hasValidationError(errs, "return_model.history.months", errCodeMismatch) {
+		t.Error("Expected a label for every month, got", errs)
+	}
+	if hasValidationError(errs, "number_of_trials", errCodeOutOfRange) {
+		t.Error("Expected number_of_trials to be ignored when backtesting")
+	}
+
+	s = validSimulationData()
+	s.Mode = "replay"
+	if errs := s.Validate(); !hasValidationError(errs, "mode", errCodeInvalid) {
+		t.Error("Expected an unknown mode to be invalid, got", errs)
+	}
+}
@@ -0,0 +1,168 @@
+package simulation
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+// bootstrapReturnModel resamples historical returns instead of drawing them
+// from a distribution
+const bootstrapReturnModel = "bootstrap"
+
+// defaultBlockLength is the number of contiguous months resampled at a time
+const defaultBlockLength = 12
+
+// ReturnHistory is a set of historical monthly returns (e.g. 0.01 for 1%),
+// aligned by month - every series must be the same length.
+type ReturnHistory struct {
+	Assets     map[string][]float64 `json:"assets"` // by asset class
+	Inflation  []float64            `json:"inflation"`
+	RealEstate []float64            `json:"real_estate"`
+	Months     []string             `json:"months"` // optional label for each month, e.g. "1929-01"
+}
+
+// defaultReturnHistory is used by the bootstrap model and backtests when a
+// request doesn't supply its own history. Set at server startup.
+var defaultReturnHistory *ReturnHistory
+
+func init() {
+	RegisterReturnModel(bootstrapReturnModel, newBootstrapModel)
+}
+
+// SetDefaultReturnHistory sets the history the bootstrap model and backtests
+// use when a request doesn't supply one. Not safe to call while simulations are running.
+// Params: history *ReturnHistory
+// Returns: None
+func SetDefaultReturnHistory(history *ReturnHistory) {
+	defaultReturnHistory = history
+}
+
+// LoadReturnHistoryCSV reads a return history from CSV. The first row is a
+// header naming each column - "inflation", "real_estate" or an asset class id.
+// A "month" or "date" column, if present, labels each month. Each following row
+// is one month's returns.
+// Params: r io.Reader
+// Returns: *ReturnHistory, error
+func LoadReturnHistoryCSV(r io.Reader) (*ReturnHistory, error) {
+	rows, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) < 2 {
+		return nil, fmt.Errorf("return history needs a header and at least one month")
+	}
+
+	history := &ReturnHistory{Assets: map[string][]float64{}}
+	header := rows[0]
+	for column, name := range header {
+		name = strings.TrimSpace(name)
+		switch strings.ToLower(name) {
+		case "month", "date":
+			history.Months = make([]string, len(rows)-1)
+			for i, row := range rows[1:] {
+				history.Months[i] = strings.TrimSpace(row[column])
+			}
+			continue
+		}
+
+		series := make([]float64, len(rows)-1)
+		for i, row := range rows[1:] {
+			series[i], err = strconv.ParseFloat(strings.TrimSpace(row[column]), 64)
+			if err != nil {
+				return nil, fmt.Errorf("row %d, column %s: %v", i+2, name, err)
+			}
+		}
+
+		switch strings.ToLower(name) {
+		case "inflation":
+			history.Inflation = series
+		case "real_estate":
+			history.RealEstate = series
+		default:
+			history.Assets[name] = series
+		}
+	}
+	return history, nil
+}
+
+// months returns the number of months of history
+// Receiver: ReturnHistory
+// Params: None
+// Returns: int
+func (h *ReturnHistory) months() int {
+	return len(h.Inflation)
+}
+
+// returnHistory returns the history the bootstrap model or backtests will use -
+// the request's own, or the default
+// Receiver: SimulationData
+// Params: None
+// Returns: *ReturnHistory
+func (s *SimulationData) returnHistory() *ReturnHistory {
+	if s.ReturnModel.History != nil {
+		return s.ReturnModel.History
+	}
+	return defaultReturnHistory
+}
+
+// bootstrapModel builds each trial by stitching together randomly chosen
+// blocks of contiguous historical months. All series are sampled from the same
+// months, so correlation between assets - and within a block, autocorrelation -
+// is kept.
+type bootstrapModel struct {
+	history     *ReturnHistory
+	blockLength int
+}
+
+// newBootstrapModel returns a bootstrap model for a simulation
+// Params: s *SimulationData
+// Returns: ReturnModel
+func newBootstrapModel(s *SimulationData) ReturnModel {
+	history := s.returnHistory()
+	blockLength := s.ReturnModel.BlockLength
+	if blockLength == 0 {
+		blockLength = defaultBlockLength
+	}
+	if history != nil && blockLength > history.months() {
+		blockLength = history.months()
+	}
+	return bootstrapModel{history: history, blockLength: blockLength}
+}
+
+// Generate resamples performance results for real estate, inflation and each
+// asset class in the selected portfolio
+// Receiver: bootstrapModel
+// Params: s *SimulationData
+// Params: numberOfMonths int -- number of periods to model
+// Params: rng *rand.Rand -- the trial's random stream
+// Returns: MarketPath
+func (b bootstrapModel) Generate(s *SimulationData, numberOfMonths int, rng *rand.Rand) MarketPath {
+	assetClassIds := s.assetClassIds()
+	path := MarketPath{
+		RealEstate: make(returnsList, numberOfMonths),
+		Inflation:  make(returnsList, numberOfMonths),
+		Assets:     make(returnResultsByAsset, len(assetClassIds)),
+	}
+	for _, assetClassId := range assetClassIds {
+		path.Assets[assetClassId] = make(returnsList, numberOfMonths)
+	}
+
+	for monthIndex := 0; monthIndex < numberOfMonths; {
+		start := rng.Intn(b.history.months() - b.blockLength + 1)
+		for i := start; i < start+b.blockLength && monthIndex < numberOfMonths; i++ {
+			path.Inflation[monthIndex] = b.history.Inflation[i]
+			if b.history.RealEstate != nil {
+				path.RealEstate[monthIndex] = b.history.RealEstate[i]
+			}
+			for _, assetClassId := range assetClassIds {
+				path.Assets[assetClassId][monthIndex] = b.history.Assets[assetClassId][i]
+			}
+			monthIndex++
+		}
+	}
+	return path
+}
@@ -0,0 +1,135 @@
+package simulation
+
+import (
+	"context"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// sequentialHistory returns a history where every series holds its month
+// index, so the month a resampled value came from is easy to see
+func sequentialHistory(months int) *ReturnHistory {
+	history := &ReturnHistory{Assets: map[string][]float64{}}
+	for _, assetClassId := range []string{"INTL-BOND", "US-REALESTATE", "CDN-REALESTATE"} {
+		history.Assets[assetClassId] = make([]float64, months)
+	}
+	history.Inflation = make([]float64, months)
+	history.RealEstate = make([]float64, months)
+	for i := 0; i < months; i++ {
+		history.Inflation[i] = float64(i)
+		history.RealEstate[i] = float64(i)
+		for _, series := range history.Assets {
+			series[i] = float64(i)
+		}
+	}
+	return history
+}
+
+func TestBootstrapResamplesContiguousBlocks(t *testing.T) {
+	s := validSimulationData()
+	s.ReturnModel = ReturnModelSettings{Type: bootstrapReturnModel, BlockLength: 6, History: sequentialHistory(40)}
+	path := newBootstrapModel(s).Generate(s, 100, rand.New(rand.NewSource(1)))
+
+	if len(path.Inflation) != 100 || len(path.Assets["INTL-BOND"]) != 100 {
+		t.Fatal("Expected 100 months, got", len(path.Inflation))
+	}
+	for m := 0; m < 100; m++ {
+		month := path.Inflation[m]
+		if path.RealEstate[m] != month || path.Assets["INTL-BOND"][m] != month || path.Assets["CDN-REALESTATE"][m] != month {
+			t.Fatal("Expected every series to be sampled from the same month at", m)
+		}
+		if m%6 != 0 && month != path.Inflation[m-1]+1 {
+			t.Error("Expected contiguous months within a block at", m, path.Inflation[m-1], month)
+		}
+		if month < 0 || month > 39 {
+			t.Error("Expected a month in the history, got", month)
+		}
+	}
+}
+
+func TestBootstrapBlockLengthIsLimitedToHistory(t *testing.T) {
+	s := validSimulationData()
+	s.ReturnModel = ReturnModelSettings{Type: bootstrapReturnModel, History: sequentialHistory(5)}
+	path := newBootstrapModel(s).Generate(s, 12, rand.New(rand.NewSource(1)))
+	for m, month := range path.Inflation {
+		if month != float64(m%5) {
+			t.Error("Expected the whole history to be repeated, got", path.Inflation)
+			break
+		}
+	}
+}
+
+func TestSimulateWithBootstrapUsesDefaultHistory(t *testing.T) {
+	history := sequentialHistory(24)
+	for i := range history.Inflation {
+		history.Inflation[i] = 0.001
+		history.RealEstate[i] = 0.002
+		for _, series := range history.Assets {
+			series[i] = 0.004
+		}
+	}
+	SetDefaultReturnHistory(history)
+	defer SetDefaultReturnHistory(nil)
+
+	s := validSimulationData()
+	s.ReturnModel.Type = bootstrapReturnModel
+	s.CholeskyDecomposition = nil
+	s.AssetPerformanceData = nil
+	if errs := s.Validate(); len(errs) != 0 {
+		t.Fatal("Expected no errors, got", errs)
+	}
+	if _, err := Simulate(context.Background(), s, DefaultLimits()); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestLoadReturnHistoryCSV(t *testing.T) {
+	history, err := LoadReturnHistoryCSV(strings.NewReader("month,inflation,real_estate,INTL-BOND\n1970-01,0.002,0.01,-0.03\n1970-02, 0.001,0.005,0.02\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if history.months() != 2 || history.Inflation[1] != 0.001 || history.RealEstate[0] != 0.01 {
+		t.Error("Expected inflation and real estate to be loaded, got", history)
+	}
+	if bonds := history.Assets["INTL-BOND"]; len(bonds) != 2 || bonds[0] != -0.03 {
+		t.Error("Expected asset returns to be loaded, got", history.Assets)
+	}
+	if len(history.Assets) != 1 || len(history.Months) != 2 || history.Months[0] != "1970-01" {
+		t.Error("Expected the month column to label each month, got", history.Months, history.Assets)
+	}
+
+	if _, err := LoadReturnHistoryCSV(strings.NewReader("inflation,INTL-BOND\n0.002,abc\n")); err == nil {
+		t.Error("Expected an error for a value that isn't a number")
+	}
+	if _, err := LoadReturnHistoryCSV(strings.NewReader("inflation,INTL-BOND\n")); err == nil {
+		t.Error("Expected an error for a history with no months")
+	}
+}
+
+func TestValidateBootstrapHistory(t *testing.T) {
+	s := validSimulationData()
+	s.ReturnModel.Type = bootstrapReturnModel
+	if errs := s.Validate(); !hasValidationError(errs, "return_model.history", errCodeRequired) {
+		t.Error("Expected a history to be required, got", errs)
+	}
+
+	history := sequentialHistory(24)
+	delete(history.Assets, "CDN-REALESTATE")
+	history.RealEstate = history.RealEstate[:12]
+	history.Assets["INTL-BOND"][3] = -1
+	s.ReturnModel = ReturnModelSettings{Type: bootstrapReturnModel, BlockLength: -1, History: history}
+
+	errs := s.Validate()
+	expected := []struct{ field, code string }{
+		{"return_model.block_length", errCodeOutOfRange},
+		{"return_model.history.real_estate", errCodeMismatch},
+		{"return_model.history.assets.CDN-REALESTATE", errCodeUnknownAsset},
+		{"return_model.history.assets.INTL-BOND[3]", errCodeOutOfRange},
+	}
+	for _, e := range expected {
+		if !hasValidationError(errs, e.field, e.code) {
+			t.Error("Expected", e.code, "error for", e.field, "got", errs)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package simulation
+
+import (
+	"math"
+
+	goMatrix "github.com/skelterjohn/go.matrix"
+)
+
+// Correlation matrix types
+const (
+	correlationMatrix = "correlation" // default
+	covarianceMatrix  = "covariance"
+)
+
+// inflationCorrelationKey is inflation's row and column in a correlation
+// matrix, when it's correlated with the asset classes
+const inflationCorrelationKey = "INFLATION"
+
+// minimumEigenvalue is the smallest eigenvalue a repaired matrix is left with,
+// so it is safely positive definite
+const minimumEigenvalue = 1e-6
+
+// symmetryTolerance is how far apart a matrix's mirrored values may be
+const symmetryTolerance = 1e-9
+
+// CorrelationMatrix is a correlation or covariance matrix of the asset
+// classes' monthly returns, keyed by asset class id, given in place of a
+// precomputed cholesky_decomposition. It is decomposed on the server, in
+// assetClassIds() order.
+type CorrelationMatrix struct {
+	// "correlation" (default) or "covariance". Only the correlations are used
+	// - a covariance matrix is scaled by its variances, and standard
+	// deviations still come from asset_performance_data.
+	Type string `json:"type"`
+
+	// Every asset class selected (and "INFLATION", if it's correlated) by
+	// every other. Must be symmetric.
+	Values map[string]map[string]float64 `json:"values"`
+
+	// Replace a matrix that isn't positive definite - e.g. one estimated from
+	// series of different lengths - with a nearby one that is
+	Repair bool `json:"repair"`
+}
+
+// correlationKeys returns the rows (and columns) of the correlation matrix, in
+// the order the cholesky decomposition is applied in
+// Receiver: SimulationData
+// Params: None
+// Returns: []string
+func (s *SimulationData) correlationKeys() []string {
+	keys := s.assetClassIds()
+	if s.Inflation.Correlated {
+		keys = append(keys, inflationCorrelationKey)
+	}
+	return keys
+}
+
+// correlations returns the correlation matrix in the order of the keys, scaling
+// a covariance matrix by its variances. Mirrored values are averaged so it is
+// exactly symmetric.
+// Receiver: *CorrelationMatrix
+// Params: keys []string -- every one must be in Values
+// Returns: *goMatrix.DenseMatrix
+func (c *CorrelationMatrix) correlations(keys []string) *goMatrix.DenseMatrix {
+	m := goMatrix.Zeros(len(keys), len(keys))
+	for i, row := range keys {
+		for j, column := range keys {
+			value := (c.Values[row][column] + c.Values[column][row]) / 2
+			if c.Type == covarianceMatrix {
+				value /= math.Sqrt(c.Values[row][row] * c.Values[column][column])
+			}
+			m.Set(i, j, value)
+		}
+	}
+	return m
+}
+
+// cholesky decomposes the matrix, repairing it first if it isn't positive
+// definite and that's asked for
+// Receiver: *CorrelationMatrix
+// Params: keys []string -- rows, in order
+// Returns: []float64 -- lower triangular, flattened by row, error
+func (c *CorrelationMatrix) cholesky(keys []string) ([]float64, error) {
+	m := c.correlations(keys)
+	l, err := m.Cholesky()
+	if err != nil && c.Repair {
+		l, err = nearestPositiveDefinite(m).Cholesky()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return l.Array(), nil
+}
+
+// nearestPositiveDefinite returns a positive definite correlation matrix close
+// to a symmetric one that isn't, by raising its negative (or zero) eigenvalues
+// and rescaling the result back to a unit diagonal
+// Params: m *goMatrix.DenseMatrix -- symmetric
+// Returns: *goMatrix.DenseMatrix
+func nearestPositiveDefinite(m *goMatrix.DenseMatrix) *goMatrix.DenseMatrix {
+	vectors, values, err := m.Eigen()
+	if err != nil {
+		return m
+	}
+	for i := 0; i < values.Rows(); i++ {
+		values.Set(i, i, math.Max(values.Get(i, i), minimumEigenvalue))
+	}
+	repaired := goMatrix.Product(vectors, values, vectors.Transpose())
+
+	size := repaired.Rows()
+	result := goMatrix.Zeros(size, size)
+	for i := 0; i < size; i++ {
+		for j := 0; j <= i; j++ {
+			value := repaired.Get(i, j) / math.Sqrt(repaired.Get(i, i)*repaired.Get(j, j))
+			result.Set(i, j, value)
+			result.Set(j, i, value)
+		}
+	}
+	return result
+}
+
+// choleskyValues returns the cholesky decomposition to correlate shocks with -
+// decomposed from the correlation matrix if there is one, otherwise as
+// provided but with unit rows. Worked out once, as it's the same for every
+// trial.
+// Receiver: SimulationData
+// Params: None
+// Returns: []float64 -- lower triangular, flattened by row
+func (s *SimulationData) choleskyValues() []float64 {
+	if s.cholesky == nil {
+		if s.CorrelationMatrix != nil {
+			// Already checked by Validate()
+			s.cholesky, _ = s.CorrelationMatrix.cholesky(s.correlationKeys())
+		} else {
+			s.cholesky = unitCholeskyRows(s.CholeskyDecomposition)
+		}
+	}
+	return s.cholesky
+}
+
+// unitCholeskyRows scales each row of a cholesky decomposition to unit length,
+// so it decomposes the correlation matrix rather than the covariance matrix.
+// Shocks are scaled by each distribution's std dev afterwards, and
+// cholesky_decomposition is sent at covariance scale.
+// Params: values []float64 -- lower triangular, flattened by row
+// Returns: []float64 -- a copy, rows of zeroes left as they are
+func unitCholeskyRows(values []float64) []float64 {
+	size := int(math.Sqrt(float64(len(values))))
+	scaled := make([]float64, len(values))
+	for row := 0; row < size; row++ {
+		cells := values[row*size : (row+1)*size]
+		length := 0.0
+		for _, value := range cells {
+			length += value * value
+		}
+		length = math.Sqrt(length)
+		for column, value := range cells {
+			if length > 0 {
+				scaled[row*size+column] = value / length
+			}
+		}
+	}
+	return scaled
+}
@@ -0,0 +1,196 @@
+package simulation
+
+import (
+	"context"
+	"math"
+	"testing"
+)
+
+// testCorrelations returns a correlation matrix for validSimulationData()'s
+// asset classes
+func testCorrelations() *CorrelationMatrix {
+	return &CorrelationMatrix{Values: map[string]map[string]float64{
+		"CDN-REALESTATE": {"CDN-REALESTATE": 1, "INTL-BOND": 0.5, "US-REALESTATE": 0.3},
+		"INTL-BOND":      {"CDN-REALESTATE": 0.5, "INTL-BOND": 1, "US-REALESTATE": 0.2},
+		"US-REALESTATE":  {"CDN-REALESTATE": 0.3, "INTL-BOND": 0.2, "US-REALESTATE": 1},
+	}}
+}
+
+func TestCorrelationMatrixCholesky(t *testing.T) {
+	s := validSimulationData()
+	s.CholeskyDecomposition = nil
+	s.CorrelationMatrix = testCorrelations()
+
+	b2 := math.Sqrt(0.75)
+	c2 := (0.2 - 0.5*0.3) / b2
+	expected := []float64{
+		1, 0, 0,
+		0.5, b2, 0,
+		0.3, c2, math.Sqrt(1 - 0.3*0.3 - c2*c2),
+	}
+	values := s.choleskyValues()
+	for i := range expected {
+		if !closeTo(values[i], expected[i], 1e-12) {
+			t.Error("Expected the decomposition in alphabetical order, got", values)
+			break
+		}
+	}
+}
+
+func TestCovarianceMatrixIsScaled(t *testing.T) {
+	correlations := testCorrelations()
+	covariances := &CorrelationMatrix{Type: covarianceMatrix, Values: map[string]map[string]float64{}}
+	stdDevs := map[string]float64{"CDN-REALESTATE": 0.02, "INTL-BOND": 0.005, "US-REALESTATE": 0.04}
+	for row, values := range correlations.Values {
+		covariances.Values[row] = map[string]float64{}
+		for column, value := range values {
+			covariances.Values[row][column] = value * stdDevs[row] * stdDevs[column]
+		}
+	}
+
+	keys := validSimulationData().correlationKeys()
+	fromCorrelations, _ := correlations.cholesky(keys)
+	fromCovariances, err := covariances.cholesky(keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range fromCorrelations {
+		if !closeTo(fromCorrelations[i], fromCovariances[i], 1e-12) {
+			t.Error("Expected a covariance matrix to give the same correlations, got", fromCovariances, fromCorrelations)
+			break
+		}
+	}
+}
+
+func TestCorrelationMatrixRepair(t *testing.T) {
+	s := validSimulationData()
+	s.CholeskyDecomposition = nil
+	s.CorrelationMatrix = testCorrelations()
+	// Can't be strongly correlated with both of two assets that are strongly
+	// anti-correlated
+	s.CorrelationMatrix.Values["CDN-REALESTATE"]["INTL-BOND"] = 0.9
+	s.CorrelationMatrix.Values["INTL-BOND"]["CDN-REALESTATE"] = 0.9
+	s.CorrelationMatrix.Values["CDN-REALESTATE"]["US-REALESTATE"] = 0.9
+	s.CorrelationMatrix.Values["US-REALESTATE"]["CDN-REALESTATE"] = 0.9
+	s.CorrelationMatrix.Values["INTL-BOND"]["US-REALESTATE"] = -0.9
+	s.CorrelationMatrix.Values["US-REALESTATE"]["INTL-BOND"] = -0.9
+
+	if !hasValidationError(s.Validate(), "correlation_matrix", errCodeInvalid) {
+		t.Error("Expected a matrix that isn't positive definite to be invalid")
+	}
+
+	s.CorrelationMatrix.Repair = true
+	if errs := s.Validate(); len(errs) != 0 {
+		t.Fatal("Expected the matrix to be repaired, got", errs)
+	}
+	keys := s.correlationKeys()
+	valid := testCorrelations().correlations(keys)
+	if difference, _ := nearestPositiveDefinite(valid).MinusDense(valid); difference.TwoNorm() > 1e-9 {
+		t.Error("Expected a positive definite matrix to be left alone, got", difference)
+	}
+
+	l := s.choleskyMatrix()
+	repaired, _ := l.TimesDense(l.Transpose())
+	for i, row := range keys {
+		if !closeTo(repaired.Get(i, i), 1, 1e-9) {
+			t.Error("Expected a unit diagonal, got", repaired)
+		}
+		for j, column := range keys {
+			if !closeTo(repaired.Get(i, j), s.CorrelationMatrix.Values[row][column], 0.5) {
+				t.Error("Expected the repaired matrix to stay close, got", repaired)
+			}
+		}
+	}
+}
+
+func TestValidateCorrelationMatrix(t *testing.T) {
+	s := validSimulationData()
+	s.CorrelationMatrix = testCorrelations()
+	if !hasValidationError(s.Validate(), "cholesky_decomposition", errCodeInvalid) {
+		t.Error("Expected only one of cholesky_decomposition and correlation_matrix to be allowed")
+	}
+
+	s.CholeskyDecomposition = nil
+	delete(s.CorrelationMatrix.Values, "US-REALESTATE")
+	if !hasValidationError(s.Validate(), "correlation_matrix.values", errCodeMismatch) {
+		t.Error("Expected a missing row to be a dimension mismatch")
+	}
+
+	s.CorrelationMatrix = testCorrelations()
+	s.Inflation.Correlated = true
+	if !hasValidationError(s.Validate(), "correlation_matrix.values", errCodeMismatch) {
+		t.Error("Expected a row and column for inflation to be required")
+	}
+
+	s.Inflation.Correlated = false
+	s.CorrelationMatrix.Values["INTL-BOND"] = map[string]float64{"CDN-REALESTATE": 0.5, "INTL-BOND": 1, "US-BOND": 0.2}
+	if !hasValidationError(s.Validate(), "correlation_matrix.values.INTL-BOND.US-REALESTATE", errCodeMismatch) {
+		t.Error("Expected a column for every asset class to be required")
+	}
+
+	s.CorrelationMatrix = testCorrelations()
+	s.CorrelationMatrix.Values["INTL-BOND"]["CDN-REALESTATE"] = 0.4
+	s.CorrelationMatrix.Values["US-REALESTATE"]["US-REALESTATE"] = 2
+	errs := s.Validate()
+	if !hasValidationError(errs, "correlation_matrix.values.INTL-BOND.CDN-REALESTATE", errCodeInvalid) {
+		t.Error("Expected an asymmetric matrix to be invalid, got", errs)
+	}
+	if !hasValidationError(errs, "correlation_matrix.values.US-REALESTATE.US-REALESTATE", errCodeOutOfRange) {
+		t.Error("Expected a correlation other than 1 on the diagonal to be invalid, got", errs)
+	}
+
+	s.CorrelationMatrix = testCorrelations()
+	s.CorrelationMatrix.Type = "partial"
+	if !hasValidationError(s.Validate(), "correlation_matrix.type", errCodeInvalid) {
+		t.Error("Expected an unknown type to be invalid")
+	}
+}
+
+func TestSimulateWithCorrelationMatrix(t *testing.T) {
+	withMatrix := validSimulationData()
+	withMatrix.Seed = 6
+	withMatrix.CholeskyDecomposition = nil
+	withMatrix.CorrelationMatrix = testCorrelations()
+	matrixResults, err := Simulate(context.Background(), withMatrix, DefaultLimits())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	flat := validSimulationData()
+	flat.Seed = 6
+	flat.CholeskyDecomposition, _ = testCorrelations().cholesky(flat.correlationKeys())
+	flatResults, _ := Simulate(context.Background(), flat, DefaultLimits())
+
+	for i, step := range matrixResults.Timesteps {
+		if !closeTo(step.AssetsMean, flatResults.Timesteps[i].AssetsMean, step.AssetsMean*1e-9) {
+			t.Error("Expected the same results as the equivalent cholesky_decomposition, got", step.AssetsMean, flatResults.Timesteps[i].AssetsMean)
+			break
+		}
+	}
+}
+
+func TestCorrelationMatrixMatchesCholeskyDecomposition(t *testing.T) {
+	withMatrix := validSimulationData()
+	withMatrix.CholeskyDecomposition = nil
+	withMatrix.CorrelationMatrix = testCorrelations()
+
+	// The same correlations at covariance scale, as Rails sends them
+	flat := validSimulationData()
+	keys := flat.correlationKeys()
+	flat.CholeskyDecomposition, _ = testCorrelations().cholesky(keys)
+	for i, id := range keys {
+		for j := range keys {
+			flat.CholeskyDecomposition[i*len(keys)+j] *= flat.AssetPerformanceData[id].StdDev
+		}
+	}
+
+	matrixReturns := generatedLogReturns(lognormalModel{}, withMatrix)
+	flatReturns := generatedLogReturns(lognormalModel{}, flat)
+	checkGeneratedStdDevs(t, withMatrix.AssetPerformanceData, matrixReturns)
+	for _, id := range keys {
+		matrixStdDev, flatStdDev := sampleStdDev(matrixReturns[id]), sampleStdDev(flatReturns[id])
+		if !closeTo(matrixStdDev, flatStdDev, flatStdDev*1e-9) {
+			t.Error("Expected", id, "to have the same std dev from either input, got", matrixStdDev, flatStdDev)
+		}
+	}
+}
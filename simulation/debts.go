@@ -0,0 +1,136 @@
+package simulation
+
+import "math"
+
+// Debt rate types
+const (
+	fixedRate    = "fixed"    // rate is fixed (default)
+	variableRate = "variable" // spread over each trial's simulated inflation
+)
+
+// Debt is an outstanding loan - a mortgage, car loan or line of credit - paid
+// down in equal monthly payments over its amortization. Payments are made from
+// income, or withdrawn from the accounts if there isn't enough.
+type Debt struct {
+	Name      string  `json:"name"`
+	Principal float64 `json:"principal"` // balance outstanding today
+
+	// "fixed" (default) or "variable"
+	RateType string  `json:"rate_type"`
+	Rate     float64 `json:"rate"`   // fixed - annual, 0 - 100
+	Spread   float64 `json:"spread"` // variable - annual percentage points over inflation
+
+	// Months left to pay it off in. The payment is recalculated whenever a
+	// variable rate changes, so it still ends on time (or sooner, with extra
+	// payments).
+	AmortizationMonths int `json:"amortization_months"`
+
+	// Paid towards principal on top of the regular payments. Same format as
+	// expenses.
+	ExtraPayments []Expense `json:"extra_payments"`
+
+	// Pay off what's left from the proceeds when the house is sold
+	PayOffOnHouseSale bool `json:"pay_off_on_house_sale"`
+
+	// Id of the property it's secured against, if any. Reduces the property's
+	// equity, and is paid off from the proceeds when it's sold. For a property
+	// bought later, the principal is borrowed on the purchase date and goes
+	// towards the purchase.
+	Property string `json:"property"`
+}
+
+// monthlyRate returns the debt's interest rate for a month
+// Receiver: Debt
+// Params: inflation float64 -- the month's simulated inflation
+// Returns: float64
+func (d *Debt) monthlyRate(inflation float64) float64 {
+	if d.RateType == variableRate {
+		return math.Max(0, inflation+d.Spread/1200)
+	}
+	return d.Rate / 1200
+}
+
+// amortizingPayment returns the level monthly payment that pays off a balance
+// over a number of months
+// Params: balance float64
+// Params: rate float64 -- monthly
+// Params: months int
+// Returns: float64
+func amortizingPayment(balance, rate float64, months int) float64 {
+	if months <= 1 {
+		return balance * (1 + rate)
+	}
+	if rate == 0 {
+		return balance / float64(months)
+	}
+	return balance * rate / (1 - math.Pow(1+rate, -float64(months)))
+}
+
+// applyDebts works out each month's debt payments and the balance left
+// owing, paying off debts from the house (or their property's) sale proceeds if
+// asked to. Properties must already be applied.
+// Receiver: SimulationData
+// Params: trialResult []simulationTimeStep
+// Params: timeSteps []*timeStep -- extra payments schedule
+// Params: inflation returnsList -- the trial's monthly inflation
+// Returns: None
+func (s *SimulationData) applyDebts(trialResult []simulationTimeStep, timeSteps []*timeStep, inflation returnsList) {
+	houseSaleMonth := -1
+	if s.Parameters.IncludeHome {
+		houseSaleMonth = s.Parameters.SellHouseIn * 12
+	}
+
+	for debtIndex := range s.Debts {
+		debt := &s.Debts[debtIndex]
+		payOffMonth := -1
+		if debt.PayOffOnHouseSale {
+			payOffMonth = houseSaleMonth
+		}
+		// A debt against a property bought later is taken out on the purchase,
+		// and goes towards it
+		startMonth := 0
+		var held propertyMonths
+		property := s.propertyIndex(debt.Property)
+		if property >= 0 {
+			held = s.propertySchedule(timeSteps)[property]
+			startMonth = held.purchase
+			payOffMonth = held.sale
+			if startMonth > 0 && startMonth < len(trialResult) {
+				trialResult[startMonth].inflows += debt.Principal
+			}
+		}
+
+		balance := debt.Principal
+		var payment float64
+		lastRate := -1.0
+		for monthIndex := startMonth; monthIndex < len(trialResult); monthIndex++ {
+			if balance <= 0 {
+				break
+			}
+			step := &trialResult[monthIndex]
+
+			// The regular payment only changes with the rate, so extra
+			// payments shorten the amortization rather than lowering it
+			rate := debt.monthlyRate(inflation[monthIndex])
+			remaining := debt.AmortizationMonths - (monthIndex - startMonth)
+			if rate != lastRate || remaining <= 1 {
+				payment = amortizingPayment(balance, rate, remaining)
+				lastRate = rate
+			}
+
+			owed := balance * (1 + rate)
+			paid := math.Min(payment+timeSteps[monthIndex].extraDebtPayments[debtIndex], owed)
+			balance = owed - paid
+			step.debtPayments += paid
+
+			if monthIndex == payOffMonth {
+				step.inflows -= balance
+				balance = 0
+			}
+			step.debts += balance
+			if property >= 0 && monthIndex >= held.purchase && monthIndex < held.sale {
+				step.propertyEquity[property] -= balance
+			}
+		}
+	}
+}
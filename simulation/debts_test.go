@@ -0,0 +1,130 @@
+package simulation
+
+import (
+	"context"
+	"testing"
+)
+
+// applyTestDebts runs applyDebts over a number of months, with flat inflation
+func applyTestDebts(s *SimulationData, numberOfMonths int, inflation float64) []simulationTimeStep {
+	trialResult := make([]simulationTimeStep, numberOfMonths)
+	inflationPath := make(returnsList, numberOfMonths)
+	for i := range inflationPath {
+		inflationPath[i] = inflation
+	}
+	s.applyDebts(trialResult, s.applyExpenses(numberOfMonths), inflationPath)
+	return trialResult
+}
+
+func TestAmortizingPayment(t *testing.T) {
+	if payment := amortizingPayment(200000, 0.005, 360); !closeTo(payment, 1199.10, 0.01) {
+		t.Error("Expected a 30 year mortgage at 6% to cost 1199.10 a month, got", payment)
+	}
+	if payment := amortizingPayment(12000, 0, 12); payment != 1000 {
+		t.Error("Expected an interest-free loan to be paid in equal parts, got", payment)
+	}
+}
+
+func TestApplyDebtsPaysOffOverAmortization(t *testing.T) {
+	s := validSimulationData()
+	s.Parameters.IncludeHome = false
+	s.Debts = []Debt{{Principal: 200000, Rate: 6, AmortizationMonths: 360}}
+	trialResult := applyTestDebts(s, 400, 0)
+
+	if !closeTo(trialResult[0].debtPayments, 1199.10, 0.01) || !closeTo(trialResult[359].debtPayments, 1199.10, 0.01) {
+		t.Error("Expected level payments, got", trialResult[0].debtPayments, trialResult[359].debtPayments)
+	}
+	if !closeTo(trialResult[0].debts, 200000+1000-1199.10, 0.01) {
+		t.Error("Expected interest added and the payment taken off, got", trialResult[0].debts)
+	}
+	if !closeTo(trialResult[359].debts, 0, 1e-6) || trialResult[360].debtPayments != 0 {
+		t.Error("Expected the debt paid off at the end of its amortization, got", trialResult[359].debts, trialResult[360].debtPayments)
+	}
+}
+
+func TestApplyDebtsExtraPayments(t *testing.T) {
+	s := validSimulationData()
+	s.Parameters.IncludeHome = false
+	s.Debts = []Debt{{Principal: 12000, AmortizationMonths: 12,
+		ExtraPayments: []Expense{{Amount: 1000, Frequency: "monthly"}}}}
+	trialResult := applyTestDebts(s, 24, 0)
+
+	if trialResult[0].debtPayments != 2000 || trialResult[5].debts != 0 || trialResult[6].debtPayments != 0 {
+		t.Error("Expected extra payments to pay the debt off early, got", trialResult[0].debtPayments, trialResult[5].debts)
+	}
+}
+
+func TestApplyDebtsVariableRate(t *testing.T) {
+	s := validSimulationData()
+	s.Parameters.IncludeHome = false
+	s.Debts = []Debt{{RateType: variableRate, Spread: 2.4, Principal: 10000, AmortizationMonths: 60}}
+	trialResult := applyTestDebts(s, 60, 0.003)
+
+	// 0.3% inflation plus 0.2% a month
+	if payment := amortizingPayment(10000, 0.005, 60); !closeTo(trialResult[0].debtPayments, payment, 1e-9) {
+		t.Error("Expected the rate to follow inflation, got", trialResult[0].debtPayments, payment)
+	}
+}
+
+func TestApplyDebtsPaidOffFromHouseSale(t *testing.T) {
+	s := validSimulationData()
+	s.Parameters.SellHouseIn = 1
+	s.Debts = []Debt{{Principal: 12000, AmortizationMonths: 24, PayOffOnHouseSale: true}}
+	trialResult := applyTestDebts(s, 24, 0)
+
+	if trialResult[12].inflows != -5500 || trialResult[12].debts != 0 || trialResult[13].debtPayments != 0 {
+		t.Error("Expected the rest paid from the sale, got", trialResult[12].inflows, trialResult[12].debts)
+	}
+}
+
+func TestSimulateWithDebts(t *testing.T) {
+	s := validSimulationData()
+	s.Seed = 8
+	withoutDebt, _ := Simulate(context.Background(), s, DefaultLimits())
+	if withoutDebt.Timesteps[0].Debts != nil || withoutDebt.Timesteps[0].NetWorth != nil {
+		t.Error("Expected no debts reported without debts")
+	}
+
+	s = validSimulationData()
+	s.Seed = 8
+	s.Debts = []Debt{{Name: "car", Principal: 30000, Rate: 5, AmortizationMonths: 60}}
+	result, err := Simulate(context.Background(), s, DefaultLimits())
+	if err != nil {
+		t.Fatal(err)
+	}
+	step := result.Timesteps[12]
+	if step.Debts.Mean <= 0 || !closeTo(step.NetWorth.Mean, step.AssetsMean-step.Debts.Mean, 1e-6) {
+		t.Error("Expected net worth to be assets less debts, got", step.NetWorth.Mean, step.AssetsMean, step.Debts.Mean)
+	}
+	if step.AssetsMean >= withoutDebt.Timesteps[12].AssetsMean {
+		t.Error("Expected payments to come out of savings")
+	}
+	if result.Timesteps[61].Debts.Mean != 0 {
+		t.Error("Expected the loan paid off, got", result.Timesteps[61].Debts.Mean)
+	}
+}
+
+func TestValidateDebts(t *testing.T) {
+	s := validSimulationData()
+	s.Parameters.IncludeHome = false
+	s.Debts = []Debt{
+		{Principal: -1, Rate: 120, AmortizationMonths: 0, PayOffOnHouseSale: true},
+		{RateType: "teaser", AmortizationMonths: 12},
+	}
+	errs := s.Validate()
+	if !hasValidationError(errs, "debts[0].principal", errCodeOutOfRange) {
+		t.Error("Expected a negative principal to be invalid, got", errs)
+	}
+	if !hasValidationError(errs, "debts[0].rate", errCodeOutOfRange) {
+		t.Error("Expected a rate over 100 to be invalid, got", errs)
+	}
+	if !hasValidationError(errs, "debts[0].amortization_months", errCodeOutOfRange) {
+		t.Error("Expected a missing amortization to be invalid, got", errs)
+	}
+	if !hasValidationError(errs, "debts[0].pay_off_on_house_sale", errCodeMismatch) {
+		t.Error("Expected paying off from a house sale without a house to be invalid, got", errs)
+	}
+	if !hasValidationError(errs, "debts[1].rate_type", errCodeInvalid) {
+		t.Error("Expected an unknown rate type to be invalid, got", errs)
+	}
+}
@@ -0,0 +1,128 @@
+package simulation
+
+// Fees are the investment costs taken from the portfolio each month, on top of
+// the gross returns the return model generates
+type Fees struct {
+	// Management expense ratio of each asset class's funds - annual percentage
+	// of the amount held, e.g. 2 for a mutual fund or 0.2 for an ETF
+	ExpenseRatios map[string]float64 `json:"expense_ratios"`
+
+	// Advisory fee - annual percentage of total assets
+	AdvisoryFee float64 `json:"advisory_fee"`
+
+	// Instead of a flat advisory fee, rates that fall as assets grow
+	AdvisoryTiers []FeeTier `json:"advisory_tiers"`
+}
+
+// FeeTier is the advisory fee rate paid on total assets above the threshold,
+// up to the next tier's threshold. Thresholds are nominal, not indexed to
+// inflation.
+type FeeTier struct {
+	Threshold float64 `json:"threshold"`
+	Rate      float64 `json:"rate"` // annual, 0 - 100
+}
+
+// enabled Determines if any fees are charged
+// Receiver: Fees
+// Params: None
+// Returns: bool
+func (f *Fees) enabled() bool {
+	return len(f.ExpenseRatios) > 0 || f.AdvisoryFee != 0 || len(f.AdvisoryTiers) > 0
+}
+
+// monthlyExpenseRatios returns each asset class's expense ratio as a monthly
+// series, so a portfolio's can be weighted the same way as its returns
+// Receiver: SimulationData
+// Params: numberOfMonths int
+// Returns: returnResultsByAsset
+func (s *SimulationData) monthlyExpenseRatios(numberOfMonths int) returnResultsByAsset {
+	ratios := make(returnResultsByAsset, len(s.SelectedPortfolioWeights))
+	for _, assetClassId := range s.assetClassIds() {
+		series := make(returnsList, numberOfMonths)
+		for i := range series {
+			series[i] = s.Fees.ExpenseRatios[assetClassId] / 1200
+		}
+		ratios[assetClassId] = series
+	}
+	return ratios
+}
+
+// monthlyAdvisoryFee returns a month's advisory fee
+// Receiver: Fees
+// Params: assets float64 -- total assets
+// Returns: float64
+func (f *Fees) monthlyAdvisoryFee(assets float64) float64 {
+	if assets <= 0 {
+		return 0
+	}
+	if len(f.AdvisoryTiers) == 0 {
+		return assets * f.AdvisoryFee / 1200
+	}
+
+	fee := 0.0
+	for i, tier := range f.AdvisoryTiers {
+		if assets <= tier.Threshold {
+			break
+		}
+		upper := assets
+		if i+1 < len(f.AdvisoryTiers) && f.AdvisoryTiers[i+1].Threshold < assets {
+			upper = f.AdvisoryTiers[i+1].Threshold
+		}
+		fee += (upper - tier.Threshold) * tier.Rate / 100
+	}
+	return fee / 12
+}
+
+// chargeFees takes a month's expense ratios and advisory fee from the
+// accounts. The advisory fee is taken from each account in proportion to its
+// balance.
+// Receiver: SimulationData
+// Params: balances []float64 -- by account, updated
+// Params: portfolios []*holdings -- by account, if tracking holdings
+// Params: expenseRatios []returnsList -- by account, if not tracking holdings
+// Params: monthIndex int
+// Returns: float64 -- fees paid
+func (s *SimulationData) chargeFees(balances []float64, portfolios []*holdings, expenseRatios []returnsList, monthIndex int) float64 {
+	fees := 0.0
+	assets := 0.0
+	for i, balance := range balances {
+		if balance <= 0 {
+			continue
+		}
+		var fee float64
+		switch {
+		case portfolios != nil:
+			fee = portfolios[i].chargeExpenses()
+		case expenseRatios != nil:
+			fee = balance * expenseRatios[i][monthIndex]
+		}
+		balances[i] -= fee
+		fees += fee
+		assets += balances[i]
+	}
+
+	advisoryFee := s.Fees.monthlyAdvisoryFee(assets)
+	if advisoryFee == 0 {
+		return fees
+	}
+	for i, balance := range balances {
+		if balance > 0 {
+			balances[i] -= advisoryFee * balance / assets
+		}
+	}
+	return fees + advisoryFee
+}
+
+// chargeExpenses takes a month's expense ratios from the holdings
+// Receiver: *holdings
+// Params: None
+// Returns: float64 -- fees paid
+func (h *holdings) chargeExpenses() float64 {
+	fees := 0.0
+	for i, ratio := range h.expenseRatios {
+		fee := h.values[i] * ratio
+		h.values[i] -= fee
+		fees += fee
+	}
+	return fees
+}
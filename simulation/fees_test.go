@@ -0,0 +1,102 @@
+package simulation
+
+import (
+	"context"
+	"testing"
+)
+
+func TestMonthlyAdvisoryFee(t *testing.T) {
+	flat := Fees{AdvisoryFee: 1.2}
+	if fee := flat.monthlyAdvisoryFee(100000); !closeTo(fee, 100, 1e-9) {
+		t.Error("Expected 1.2% a year of 100000 to be 100 a month, got", fee)
+	}
+	if fee := flat.monthlyAdvisoryFee(-500); fee != 0 {
+		t.Error("Expected no fee once out of money, got", fee)
+	}
+
+	tiered := Fees{AdvisoryTiers: []FeeTier{{Threshold: 0, Rate: 1.2}, {Threshold: 1000000, Rate: 0.6}}}
+	if fee := tiered.monthlyAdvisoryFee(500000); !closeTo(fee, 500, 1e-9) {
+		t.Error("Expected the first tier's rate below the second's threshold, got", fee)
+	}
+	// 1.2% of the first million, 0.6% of the next
+	if fee := tiered.monthlyAdvisoryFee(2000000); !closeTo(fee, (12000+6000)/12.0, 1e-9) {
+		t.Error("Expected each tier's rate on the assets within it, got", fee)
+	}
+}
+
+func TestChargeFees(t *testing.T) {
+	s := validSimulationData()
+	s.Fees = Fees{AdvisoryFee: 1.2}
+	balances := []float64{30000, 70000, -100}
+	expenseRatios := []returnsList{{0.01}, {0}, {0.01}}
+
+	fees := s.chargeFees(balances, nil, expenseRatios, 0)
+	// 300 of expenses, then 0.1% a month of the remaining 99700, split by balance
+	if !closeTo(fees, 300+99.7, 1e-9) {
+		t.Error("Expected expenses plus the advisory fee, got", fees)
+	}
+	if !closeTo(balances[0], 29700-29.7, 1e-9) || !closeTo(balances[1], 70000-70, 1e-9) {
+		t.Error("Expected the advisory fee taken in proportion to balances, got", balances)
+	}
+	if balances[2] != -100 {
+		t.Error("Expected no fees from an overdrawn account, got", balances[2])
+	}
+}
+
+func TestHoldingsChargeExpenses(t *testing.T) {
+	h := &holdings{values: []float64{600, 400}, expenseRatios: []float64{0.01, 0.001}}
+	if fees := h.chargeExpenses(); !closeTo(fees, 6.4, 1e-9) || !closeTo(h.values[0], 594, 1e-9) || !closeTo(h.values[1], 399.6, 1e-9) {
+		t.Error("Expected each holding charged its own expense ratio, got", fees, h.values)
+	}
+}
+
+func TestSimulateWithFees(t *testing.T) {
+	s := validSimulationData()
+	s.Seed = 3
+	gross, _ := Simulate(context.Background(), s, DefaultLimits())
+	if gross.Timesteps[1].Fees != nil || gross.Summary.TotalFees != nil {
+		t.Error("Expected no fees reported without fees")
+	}
+
+	for _, rebalancing := range []string{"monthly", "annual"} {
+		s = validSimulationData()
+		s.Seed = 3
+		s.Rebalancing = RebalancingPolicy{Type: rebalancing}
+		s.Fees = Fees{ExpenseRatios: map[string]float64{"INTL-BOND": 2, "US-REALESTATE": 2, "CDN-REALESTATE": 2}, AdvisoryFee: 1}
+		net, err := Simulate(context.Background(), s, DefaultLimits())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if net.Timesteps[12].AssetsMean >= gross.Timesteps[12].AssetsMean {
+			t.Error("Expected fees to drag on assets with rebalancing", rebalancing)
+		}
+		if net.Timesteps[12].Fees.Mean <= net.Timesteps[1].Fees.Mean || net.Timesteps[1].Fees.Mean <= 0 {
+			t.Error("Expected cumulative fees to grow, got", net.Timesteps[1].Fees.Mean, net.Timesteps[12].Fees.Mean)
+		}
+		if net.Summary.TotalFees == nil || net.Summary.TotalFees.Mean < net.Timesteps[12].Fees.Mean {
+			t.Error("Expected a plan-level total of fees, got", net.Summary.TotalFees)
+		}
+	}
+}
+
+func TestValidateFees(t *testing.T) {
+	s := validSimulationData()
+	s.Fees = Fees{
+		ExpenseRatios: map[string]float64{"GOLD": 0.4, "INTL-BOND": -1},
+		AdvisoryFee:   1,
+		AdvisoryTiers: []FeeTier{{Threshold: 500000, Rate: 1}, {Threshold: 100000, Rate: 0.5}},
+	}
+	errs := s.Validate()
+	if !hasValidationError(errs, "fees.expense_ratios.GOLD", errCodeUnknownAsset) {
+		t.Error("Expected an asset class not in the portfolio to be invalid, got", errs)
+	}
+	if !hasValidationError(errs, "fees.expense_ratios.INTL-BOND", errCodeOutOfRange) {
+		t.Error("Expected a negative expense ratio to be invalid, got", errs)
+	}
+	if !hasValidationError(errs, "fees.advisory_tiers", errCodeInvalid) {
+		t.Error("Expected a flat fee with tiers to be invalid, got", errs)
+	}
+	if !hasValidationError(errs, "fees.advisory_tiers[1].threshold", errCodeInvalid) {
+		t.Error("Expected unsorted tiers to be invalid, got", errs)
+	}
+}
@@ -0,0 +1,163 @@
+package simulation
+
+import "sort"
+
+// Glide path bases - what a waypoint's "at" is measured in
+const (
+	ageBasis               = "age"                 // primary person's age (default)
+	yearsToRetirementBasis = "years_to_retirement" // negative once retired
+)
+
+// GlidePath changes the selected portfolio's weights with the primary person's
+// age. Weights are interpolated linearly between waypoints, and held at the
+// first / last waypoint's before / after them. Applies to every account
+// without its own portfolio weights.
+type GlidePath struct {
+	Basis     string              `json:"basis"` // "age" (default) or "years_to_retirement"
+	Waypoints []GlidePathWaypoint `json:"waypoints"`
+
+	// Instead of waypoints, a named preset (see glidePathPresets) that moves
+	// between two portfolios - all growth to all defensive.
+	Preset           string             `json:"preset"`
+	GrowthWeights    map[string]float64 `json:"growth_weights"`
+	DefensiveWeights map[string]float64 `json:"defensive_weights"`
+}
+
+// GlidePathWaypoint is the portfolio to hold at an age (or years to retirement)
+type GlidePathWaypoint struct {
+	At      float64            `json:"at"`
+	Weights map[string]float64 `json:"weights"`
+}
+
+// glidePathPreset is a named glide path, as the fraction in the growth
+// portfolio at each waypoint
+type glidePathPreset struct {
+	basis  string
+	at     []float64
+	growth []float64
+}
+
+// glidePathPresets are the glide paths that can be chosen by name
+var glidePathPresets = map[string]glidePathPreset{
+	// Bonds (defensive) equal to your age
+	"age_in_bonds": {basis: ageBasis, at: []float64{0, 100}, growth: []float64{1, 0}},
+
+	// Target date funds - mostly growth until 25 years out, easing down
+	// through retirement, and level 7 years after it.
+	"target_date":              {basis: yearsToRetirementBasis, at: []float64{25, 0, -7}, growth: []float64{0.9, 0.5, 0.3}},
+	"target_date_conservative": {basis: yearsToRetirementBasis, at: []float64{25, 0, -7}, growth: []float64{0.7, 0.4, 0.2}},
+}
+
+// glidePathPresetNames returns the names of the glide path presets, sorted
+// Params: None
+// Returns: []string
+func glidePathPresetNames() []string {
+	names := make([]string, 0, len(glidePathPresets))
+	for name := range glidePathPresets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// enabled Determines if the portfolio follows a glide path
+// Receiver: GlidePath
+// Params: None
+// Returns: bool
+func (g *GlidePath) enabled() bool {
+	return g.Preset != "" || len(g.Waypoints) > 0
+}
+
+// waypoints returns the glide path's waypoints and basis, building them from
+// the preset if there is one
+// Receiver: GlidePath
+// Params: None
+// Returns: []GlidePathWaypoint, string
+func (g *GlidePath) waypoints() ([]GlidePathWaypoint, string) {
+	preset, ok := glidePathPresets[g.Preset]
+	if !ok {
+		return g.Waypoints, g.Basis
+	}
+
+	waypoints := make([]GlidePathWaypoint, len(preset.at))
+	for i, at := range preset.at {
+		weights := map[string]float64{}
+		for assetClassId, weight := range g.GrowthWeights {
+			weights[assetClassId] += preset.growth[i] * weight
+		}
+		for assetClassId, weight := range g.DefensiveWeights {
+			weights[assetClassId] += (1 - preset.growth[i]) * weight
+		}
+		waypoints[i] = GlidePathWaypoint{At: at, Weights: weights}
+	}
+	return waypoints, preset.basis
+}
+
+// glidePathWeights works out the selected portfolio's weights in each month,
+// by asset class (in assetClassIds() order). The same for every trial, so it is
+// worked out once.
+// Receiver: SimulationData
+// Params: numberOfMonths int
+// Returns: [][]float64 -- by month, then asset class
+func (s *SimulationData) glidePathWeights(numberOfMonths int) [][]float64 {
+	if len(s.glideWeights) >= numberOfMonths {
+		return s.glideWeights
+	}
+
+	waypoints, basis := s.GlidePath.waypoints()
+	waypoints = append([]GlidePathWaypoint(nil), waypoints...)
+	sort.SliceStable(waypoints, func(i, j int) bool { return waypoints[i].At < waypoints[j].At })
+
+	assetClassIds := s.assetClassIds()
+	retirementAge := s.Parameters.RetirementAgeFemale
+	if s.Parameters.Male {
+		retirementAge = s.Parameters.RetirementAgeMale
+	}
+
+	weights := make([][]float64, numberOfMonths)
+	for monthIndex := range weights {
+		x := float64(s.primaryAge()) + float64(monthIndex)/12
+		if basis == yearsToRetirementBasis {
+			x = float64(retirementAge) - x
+		}
+
+		// Interpolate between the waypoints either side
+		next := sort.Search(len(waypoints), func(i int) bool { return waypoints[i].At >= x })
+		previous := next - 1
+		fraction := 0.0
+		switch {
+		case next == 0:
+			previous = 0
+		case next == len(waypoints):
+			next = previous
+		default:
+			fraction = (x - waypoints[previous].At) / (waypoints[next].At - waypoints[previous].At)
+		}
+
+		weights[monthIndex] = make([]float64, len(assetClassIds))
+		for i, assetClassId := range assetClassIds {
+			from := waypoints[previous].Weights[assetClassId]
+			to := waypoints[next].Weights[assetClassId]
+			weights[monthIndex][i] = from + (to-from)*fraction
+		}
+	}
+	s.glideWeights = weights
+	return weights
+}
+
+// glidePathPerformance consolidates the asset-level data into a single value
+// for the selected portfolio, with the weights following the glide path.
+// Receiver: SimulationData
+// Params: assetPerformance returnResultsByAsset -- returns by asset class
+// Params: numberOfMonths int -- number of periods to model
+// Returns: returnsList
+func (s *SimulationData) glidePathPerformance(assetPerformance returnResultsByAsset, numberOfMonths int) returnsList {
+	weights := s.glidePathWeights(numberOfMonths)
+	portfolioReturns := make(returnsList, numberOfMonths)
+	for i, assetClassId := range s.assetClassIds() {
+		for periodIndex, periodReturn := range assetPerformance[assetClassId][:numberOfMonths] {
+			portfolioReturns[periodIndex] += periodReturn * weights[periodIndex][i]
+		}
+	}
+	return portfolioReturns
+}
@@ -0,0 +1,145 @@
+package simulation
+
+import (
+	"context"
+	"testing"
+)
+
+// bondsToRealEstate returns a glide path from all INTL-BOND at 29 (the
+// primary person's age) to all US-REALESTATE at 39
+func bondsToRealEstate() GlidePath {
+	return GlidePath{Waypoints: []GlidePathWaypoint{
+		{At: 39, Weights: map[string]float64{"US-REALESTATE": 1}},
+		{At: 29, Weights: map[string]float64{"INTL-BOND": 1}},
+	}}
+}
+
+func TestGlidePathInterpolatesByAge(t *testing.T) {
+	s := validSimulationData()
+	s.GlidePath = bondsToRealEstate()
+	weights := s.glidePathWeights(200)
+
+	// CDN-REALESTATE, INTL-BOND, US-REALESTATE
+	if weights[0][0] != 0 || weights[0][1] != 1 || weights[0][2] != 0 {
+		t.Error("Expected the first waypoint's weights at the start, got", weights[0])
+	}
+	if !closeTo(weights[60][1], 0.5, 1e-9) || !closeTo(weights[60][2], 0.5, 1e-9) {
+		t.Error("Expected halfway weights at 34, got", weights[60])
+	}
+	if weights[199][1] != 0 || weights[199][2] != 1 {
+		t.Error("Expected the last waypoint's weights to be held after it, got", weights[199])
+	}
+}
+
+func TestGlidePathPresetByYearsToRetirement(t *testing.T) {
+	s := validSimulationData()
+	s.GlidePath = GlidePath{
+		Preset:           "target_date",
+		GrowthWeights:    map[string]float64{"US-REALESTATE": 1},
+		DefensiveWeights: map[string]float64{"INTL-BOND": 1},
+	}
+	weights := s.glidePathWeights(600)
+
+	// 33 years from retiring at 62
+	if !closeTo(weights[0][2], 0.9, 1e-9) || !closeTo(weights[0][1], 0.1, 1e-9) {
+		t.Error("Expected the most growth while far from retirement, got", weights[0])
+	}
+	if !closeTo(weights[33*12][2], 0.5, 1e-9) {
+		t.Error("Expected half growth at retirement, got", weights[33*12])
+	}
+	if !closeTo(weights[45*12][2], 0.3, 1e-9) {
+		t.Error("Expected the least growth after retirement, got", weights[45*12])
+	}
+}
+
+func TestGlidePathPerformance(t *testing.T) {
+	s := validSimulationData()
+	s.GlidePath = bondsToRealEstate()
+	assetPerformance := returnResultsByAsset{
+		"CDN-REALESTATE": make(returnsList, 121),
+		"INTL-BOND":      make(returnsList, 121),
+		"US-REALESTATE":  make(returnsList, 121),
+	}
+	for i := range assetPerformance["INTL-BOND"] {
+		assetPerformance["INTL-BOND"][i] = 0.01
+		assetPerformance["US-REALESTATE"][i] = 0.03
+	}
+
+	returns := s.glidePathPerformance(assetPerformance, 121)
+	if !closeTo(returns[0], 0.01, 1e-9) || !closeTo(returns[60], 0.02, 1e-9) || !closeTo(returns[120], 0.03, 1e-9) {
+		t.Error("Expected returns to follow the glide path, got", returns[0], returns[60], returns[120])
+	}
+}
+
+func TestHoldingsFollowGlidePath(t *testing.T) {
+	h := &holdings{
+		returns: []returnsList{{0, 0}, {0, 0}},
+		targets: []float64{1, 0},
+		values:  []float64{100, 0},
+		glide:   [][]float64{{1, 0}, {0.5, 0.5}},
+	}
+	h.settle(100, &RebalancingPolicy{Type: "annual"}, 1)
+	if h.values[0] != 100 || h.targets[1] != 0.5 {
+		t.Error("Expected the targets to move without a rebalance, got", h.values, h.targets)
+	}
+	h.settle(120, &RebalancingPolicy{Type: "never"}, 1)
+	if h.values[0] != 110 || h.values[1] != 10 {
+		t.Error("Expected deposits invested at the glide path's weights, got", h.values)
+	}
+}
+
+func TestSimulateWithGlidePath(t *testing.T) {
+	s := validSimulationData()
+	s.Seed = 5
+	expected, _ := Simulate(context.Background(), s, DefaultLimits())
+
+	for _, rebalancing := range []string{"monthly", "annual"} {
+		s = validSimulationData()
+		s.Seed = 5
+		s.Rebalancing = RebalancingPolicy{Type: rebalancing}
+		s.GlidePath = bondsToRealEstate()
+		result, err := Simulate(context.Background(), s, DefaultLimits())
+		if err != nil {
+			t.Fatal(err)
+		}
+		last := len(expected.Timesteps) - 1
+		if result.Timesteps[last].AssetsMean == expected.Timesteps[last].AssetsMean {
+			t.Error("Expected the glide path to change the results with rebalancing", rebalancing)
+		}
+	}
+}
+
+func TestValidateGlidePath(t *testing.T) {
+	s := validSimulationData()
+	s.GlidePath = bondsToRealEstate()
+	if errs := s.Validate(); len(errs) != 0 {
+		t.Error("Expected a valid glide path, got", errs)
+	}
+
+	s.GlidePath = GlidePath{Basis: "height", Waypoints: []GlidePathWaypoint{
+		{At: 40, Weights: map[string]float64{"INTL-BOND": 0.5, "GOLD": 0.5}},
+		{At: 40, Weights: map[string]float64{"INTL-BOND": 0.9}},
+	}}
+	errs := s.Validate()
+	if !hasValidationError(errs, "glide_path.basis", errCodeInvalid) {
+		t.Error("Expected an unknown basis to be invalid, got", errs)
+	}
+	if !hasValidationError(errs, "glide_path.waypoints[0].weights.GOLD", errCodeUnknownAsset) {
+		t.Error("Expected an asset class not in the portfolio to be invalid, got", errs)
+	}
+	if !hasValidationError(errs, "glide_path.waypoints[1].at", errCodeInvalid) {
+		t.Error("Expected a repeated waypoint to be invalid, got", errs)
+	}
+	if !hasValidationError(errs, "glide_path.waypoints[1].weights", errCodeInvalid) {
+		t.Error("Expected weights not summing to 1 to be invalid, got", errs)
+	}
+
+	s.GlidePath = GlidePath{Preset: "yolo", GrowthWeights: map[string]float64{"US-REALESTATE": 1}}
+	errs = s.Validate()
+	if !hasValidationError(errs, "glide_path.preset", errCodeInvalid) {
+		t.Error("Expected an unknown preset to be invalid, got", errs)
+	}
+	if !hasValidationError(errs, "glide_path.defensive_weights", errCodeRequired) {
+		t.Error("Expected a preset without defensive weights to be invalid, got", errs)
+	}
+}
@@ -0,0 +1,224 @@
+package simulation
+
+import "math"
+
+// People an income stream can belong to, in the order they are held in a
+// simulationTimeStep's streamIncome
+const (
+	malePerson = iota
+	femalePerson
+)
+
+// Income stream types
+const (
+	governmentStream     = "government"      // CPP / OAS, Social Security (default)
+	definedBenefitStream = "defined_benefit" // employer pension, optionally with a bridge benefit
+	annuityStream        = "annuity"         // bought from assets at the start age
+)
+
+// IncomeStream is an income paid to one person - e.g. CPP / OAS, Social
+// Security, a defined-benefit pension or an annuity - from a start age, based
+// on that person's simulated age and whether they are alive.
+type IncomeStream struct {
+	Name     string  `json:"name"`
+	Type     string  `json:"type"`      // "government" (default), "defined_benefit" or "annuity"
+	Owner    string  `json:"owner"`     // "male" or "female"
+	Amount   float64 `json:"amount"`    // annual, in today's dollars (not used by annuities)
+	StartAge int     `json:"start_age"` // age of the owner payments start at
+	EndAge   int     `json:"end_age"`   // age of the owner payments stop at, 0 for life
+
+	// Percentage of inflation payments are indexed to. Annuity payments are
+	// indexed from the purchase date.
+	Indexation float64 `json:"indexation"`
+
+	// Percentage of the payment that continues to the spouse once the owner
+	// has died (i.e. joint-and-survivor)
+	SurvivorPercentage float64 `json:"survivor_percentage"`
+
+	Clawback Clawback `json:"clawback"`
+
+	// defined_benefit - extra annual amount (in today's dollars) paid until
+	// the owner reaches the bridge end age, e.g. until government pensions
+	// start. Not paid to a survivor.
+	BridgeAmount float64 `json:"bridge_amount"`
+	BridgeEndAge int     `json:"bridge_end_age"`
+
+	// annuity - premium (in today's dollars) taken from assets at the start
+	// age if the owner is alive, and the annual payment as a percentage of
+	// the premium paid.
+	Premium    float64 `json:"premium"`
+	PayoutRate float64 `json:"payout_rate"`
+}
+
+// streamState tracks an income stream through a single trial
+type streamState struct {
+	decided       bool    // annuity - whether to buy has been decided
+	purchased     bool    // annuity - bought, so payments are made
+	premium       float64 // annuity - nominal premium paid
+	baseInflation float64 // inflation factor payments are indexed from
+}
+
+// Clawback reduces a stream (e.g. OAS) by a percentage of the recipient's
+// income above a threshold
+type Clawback struct {
+	Threshold float64 `json:"threshold"` // annual income, in today's dollars (indexed to inflation)
+	Rate      float64 `json:"rate"`      // 0 - 100, 0 for no clawback
+}
+
+// owner returns the index of the person the stream belongs to
+// Receiver: IncomeStream
+// Params: None
+// Returns: int
+func (i *IncomeStream) owner() int {
+	if i.Owner == "female" {
+		return femalePerson
+	}
+	return malePerson
+}
+
+// personAlive Determines if a person is alive in a time step
+// Params: step *simulationTimeStep
+// Params: person int
+// Returns: bool
+func personAlive(step *simulationTimeStep, person int) bool {
+	if person == femalePerson {
+		return step.femaleAlive
+	}
+	return step.maleAlive
+}
+
+// personStartingAge returns a person's age at the start of the simulation
+// Receiver: SimulationData
+// Params: person int
+// Returns: int
+func (s *SimulationData) personStartingAge(person int) int {
+	if person == femalePerson {
+		return s.Parameters.FemaleAge
+	}
+	return s.Parameters.MaleAge
+}
+
+// applyIncomeStreams adds each income stream's (pre-tax) payments to income,
+// based on its owner's age and whether they (or their spouse) are alive.
+// Inflation must already have been worked out.
+// Receiver: SimulationData
+// Params: trialResult []simulationTimeStep
+// Returns: None
+func (s *SimulationData) applyIncomeStreams(trialResult []simulationTimeStep) {
+	if len(s.IncomeStreams) == 0 {
+		return
+	}
+
+	amounts := make([]float64, len(s.IncomeStreams)) // annual payment
+	recipients := make([]int, len(s.IncomeStreams))  // person paid
+	states := make([]streamState, len(s.IncomeStreams))
+	for i := range states {
+		states[i].baseInflation = 1
+	}
+
+	for monthIndex := range trialResult {
+		step := &trialResult[monthIndex]
+		var payments [2]float64 // annual, by recipient
+
+		for i := range s.IncomeStreams {
+			s.purchaseAnnuity(&s.IncomeStreams[i], &states[i], step, monthIndex)
+			amounts[i], recipients[i] = s.streamPayment(&s.IncomeStreams[i], &states[i], step, monthIndex)
+			payments[recipients[i]] += amounts[i]
+		}
+
+		// Clawbacks are based on the recipient's income before any clawback -
+		// their share of the household's other income, plus their streams.
+		alive := 0
+		for person := range payments {
+			if personAlive(step, person) {
+				alive++
+			}
+		}
+		var clawbacks [2]float64
+		for i := range s.IncomeStreams {
+			clawback := s.IncomeStreams[i].Clawback
+			if clawback.Rate == 0 || amounts[i] == 0 {
+				continue
+			}
+			recipient := recipients[i]
+			income := payments[recipient] + 12*step.income/float64(alive)
+			excess := income - clawback.Threshold*step.inflationFactor
+			clawbacks[recipient] += math.Min(math.Max(excess, 0)*clawback.Rate/100, amounts[i])
+		}
+
+		for person := range payments {
+			monthly := (payments[person] - clawbacks[person]) / 12
+			step.streamIncome[person] = monthly
+			step.income += monthly
+		}
+	}
+}
+
+// purchaseAnnuity buys an annuity - taking the premium from assets - in the
+// first month the owner is old enough, if they are still alive.
+// Receiver: SimulationData
+// Params: stream *IncomeStream
+// Params: state *streamState
+// Params: step *simulationTimeStep
+// Params: monthIndex int
+// Returns: None
+func (s *SimulationData) purchaseAnnuity(stream *IncomeStream, state *streamState, step *simulationTimeStep, monthIndex int) {
+	if stream.Type != annuityStream || state.decided {
+		return
+	}
+	owner := stream.owner()
+	if s.personStartingAge(owner)+monthIndex/12 < stream.StartAge {
+		return
+	}
+
+	state.decided = true
+	if !personAlive(step, owner) {
+		return
+	}
+	state.purchased = true
+	state.baseInflation = step.inflationFactor
+	state.premium = stream.Premium * step.inflationFactor
+	step.inflows -= state.premium
+}
+
+// streamPayment works out a stream's annual payment in a time step, and who it
+// is paid to.
+// Receiver: SimulationData
+// Params: stream *IncomeStream
+// Params: state *streamState
+// Params: step *simulationTimeStep
+// Params: monthIndex int
+// Returns: float64, int -- annual payment (0 if none), recipient
+func (s *SimulationData) streamPayment(stream *IncomeStream, state *streamState, step *simulationTimeStep, monthIndex int) (float64, int) {
+	owner := stream.owner()
+	spouse := 1 - owner
+
+	// Ages in the time steps stop increasing at death, so work the owner's
+	// age out from their starting age.
+	age := s.personStartingAge(owner) + monthIndex/12
+	if age < stream.StartAge || (stream.EndAge != 0 && age >= stream.EndAge) {
+		return 0, owner
+	}
+
+	amount := stream.Amount
+	switch stream.Type {
+	case annuityStream:
+		if !state.purchased {
+			return 0, owner
+		}
+		amount = state.premium * stream.PayoutRate / 100
+	case definedBenefitStream:
+		if age < stream.BridgeEndAge && personAlive(step, owner) {
+			amount += stream.BridgeAmount
+		}
+	}
+	amount *= (step.inflationFactor/state.baseInflation-1)*(stream.Indexation/100) + 1
+
+	if personAlive(step, owner) {
+		return amount, owner
+	}
+	if s.Parameters.Married && personAlive(step, spouse) {
+		return amount * stream.SurvivorPercentage / 100, spouse
+	}
+	return 0, owner
+}
@@ -0,0 +1,113 @@
+package simulation
+
+import "testing"
+
+func TestIncomeStreamsFollowAgeAndSurvivorship(t *testing.T) {
+	s := &SimulationData{
+		Parameters: Parameters{Married: true, Male: true, MaleAge: 64, FemaleAge: 60},
+		IncomeStreams: []IncomeStream{
+			IncomeStream{Owner: "male", Amount: 12000, StartAge: 65, Indexation: 100, SurvivorPercentage: 60},
+			IncomeStream{Owner: "female", Amount: 6000, StartAge: 60, EndAge: 62},
+		},
+	}
+	trialResult := make([]simulationTimeStep, 36)
+	for i := range trialResult {
+		trialResult[i] = simulationTimeStep{inflationFactor: 1.5, maleAlive: i < 24, femaleAlive: true}
+	}
+
+	s.applyIncomeStreams(trialResult)
+
+	if trialResult[0].streamIncome[malePerson] != 0 || trialResult[0].streamIncome[femalePerson] != 500 {
+		t.Error("Expected only her stream before he is 65, got", trialResult[0].streamIncome)
+	}
+	if trialResult[12].streamIncome[malePerson] != 1500 || trialResult[12].income != 2000 {
+		t.Error("Expected his indexed stream at 65, got", trialResult[12].streamIncome)
+	}
+	if trialResult[24].streamIncome[malePerson] != 0 || trialResult[24].streamIncome[femalePerson] != 900 {
+		t.Error("Expected 60% of his stream paid to her after his death and hers ended, got", trialResult[24].streamIncome)
+	}
+}
+
+func TestIncomeStreamClawback(t *testing.T) {
+	s := &SimulationData{
+		Parameters: Parameters{Male: true, MaleAge: 70},
+		IncomeStreams: []IncomeStream{
+			IncomeStream{Owner: "male", Amount: 8000, StartAge: 65, Clawback: Clawback{Threshold: 90000, Rate: 15}},
+		},
+	}
+	trialResult := []simulationTimeStep{
+		simulationTimeStep{income: 8000, inflationFactor: 1, maleAlive: true},   // 96000 + 8000 a year
+		simulationTimeStep{income: 100000, inflationFactor: 1, maleAlive: true}, // fully clawed back
+	}
+
+	s.applyIncomeStreams(trialResult)
+
+	if !closeTo(trialResult[0].streamIncome[malePerson], (8000-0.15*14000)/12, 1e-9) {
+		t.Error("Expected 15% of income above the threshold clawed back, got", trialResult[0].streamIncome)
+	}
+	if trialResult[1].streamIncome[malePerson] != 0 {
+		t.Error("Expected the whole stream clawed back, got", trialResult[1].streamIncome)
+	}
+}
+
+func TestDefinedBenefitBridge(t *testing.T) {
+	s := &SimulationData{
+		Parameters: Parameters{Married: true, Male: true, MaleAge: 60, FemaleAge: 60},
+		IncomeStreams: []IncomeStream{
+			IncomeStream{Type: definedBenefitStream, Owner: "male", Amount: 24000, StartAge: 60, BridgeAmount: 12000, BridgeEndAge: 61, Indexation: 50, SurvivorPercentage: 50},
+		},
+	}
+	trialResult := make([]simulationTimeStep, 25)
+	for i := range trialResult {
+		trialResult[i] = simulationTimeStep{inflationFactor: 1.2, maleAlive: i < 24, femaleAlive: true}
+	}
+
+	s.applyIncomeStreams(trialResult)
+
+	if !closeTo(trialResult[0].streamIncome[malePerson], 3000*1.1, 1e-9) {
+		t.Error("Expected pension plus bridge, half indexed, got", trialResult[0].streamIncome)
+	}
+	if !closeTo(trialResult[12].streamIncome[malePerson], 2000*1.1, 1e-9) {
+		t.Error("Expected the bridge to end at 61, got", trialResult[12].streamIncome)
+	}
+	if !closeTo(trialResult[24].streamIncome[femalePerson], 1000*1.1, 1e-9) {
+		t.Error("Expected a 50% survivor pension, got", trialResult[24].streamIncome)
+	}
+}
+
+func TestAnnuityPurchase(t *testing.T) {
+	s := &SimulationData{
+		Parameters: Parameters{Male: true, MaleAge: 64},
+		IncomeStreams: []IncomeStream{
+			IncomeStream{Type: annuityStream, Owner: "male", StartAge: 65, Premium: 100000, PayoutRate: 6},
+		},
+	}
+	trialResult := make([]simulationTimeStep, 36)
+	for i := range trialResult {
+		trialResult[i] = simulationTimeStep{inflationFactor: 1 + float64(i)/100, maleAlive: i < 30}
+	}
+
+	s.applyIncomeStreams(trialResult)
+
+	if trialResult[11].inflows != 0 || trialResult[11].streamIncome[malePerson] != 0 {
+		t.Error("Expected nothing before the purchase")
+	}
+	if !closeTo(trialResult[12].inflows, -112000, 1e-9) {
+		t.Error("Expected the premium in today's dollars taken at 65, got", trialResult[12].inflows)
+	}
+	if !closeTo(trialResult[20].streamIncome[malePerson], 112000*0.06/12, 1e-9) {
+		t.Error("Expected an unindexed payment fixed at purchase, got", trialResult[20].streamIncome)
+	}
+	if trialResult[30].streamIncome[malePerson] != 0 {
+		t.Error("Expected payments to stop at death")
+	}
+
+	// Dies before the purchase - nothing is bought
+	for i := range trialResult {
+		trialResult[i] = simulationTimeStep{inflationFactor: 1, maleAlive: i < 6}
+	}
+	s.applyIncomeStreams(trialResult)
+	if trialResult[12].inflows != 0 {
+		t.Error("Expected no purchase after death")
+	}
+}
@@ -0,0 +1,65 @@
+package simulation
+
+import "math/rand"
+
+// Inflation models
+const (
+	iidInflation = "iid" // independent monthly draws (default)
+	ar1Inflation = "ar1" // autoregressive - shocks persist, reverting to the mean
+)
+
+// InflationDistribution is the monthly inflation rate's distribution, and how
+// it moves from month to month.
+type InflationDistribution struct {
+	Distribution // mean is the long-run monthly rate; for ar1, std_dev is the monthly shock's
+
+	Model string `json:"model"` // "iid" (default) or "ar1"
+
+	// ar1 - the fraction of last month's distance from the mean that carries
+	// over (0 - just below 1), and the rate in the month before the start.
+	// Starts at the mean if not given.
+	Persistence float64  `json:"persistence"`
+	Initial     *float64 `json:"initial"`
+
+	// Draw inflation's shocks with the asset classes', as an extra last row and
+	// column of the cholesky decomposition (lognormal model only)
+	Correlated bool `json:"correlated"`
+}
+
+// fromShocks turns standardized shocks into monthly inflation rates
+// Receiver: InflationDistribution
+// Params: shocks []float64 -- one per month
+// Returns: returnsList
+func (d *InflationDistribution) fromShocks(shocks []float64) returnsList {
+	rates := make(returnsList, len(shocks))
+	if d.Model != ar1Inflation {
+		for i, shock := range shocks {
+			rates[i] = shock*d.StdDev + d.Mean
+		}
+		return rates
+	}
+
+	previous := d.Mean
+	if d.Initial != nil {
+		previous = *d.Initial
+	}
+	for i, shock := range shocks {
+		rates[i] = d.Mean + d.Persistence*(previous-d.Mean) + d.StdDev*shock
+		previous = rates[i]
+	}
+	return rates
+}
+
+// inflationRandoms generates random inflation performance of a given length
+// based on the statistics in the SimulationData struct
+// Receiver: SimulationData
+// Params: numberOfMonths int -- number of periods to generate performance for
+// Params: rng *rand.Rand -- the trial's random stream
+// Returns: returnsList
+func (s *SimulationData) inflationRandoms(numberOfMonths int, rng *rand.Rand) returnsList {
+	shocks := make([]float64, numberOfMonths)
+	for i := range shocks {
+		shocks[i] = s.Inflation.shock(rng)
+	}
+	return s.Inflation.fromShocks(shocks)
+}
@@ -0,0 +1,123 @@
+package simulation
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestAR1InflationPersists(t *testing.T) {
+	initial := 0.01
+	d := InflationDistribution{Distribution: Distribution{Mean: 0.002}, Model: ar1Inflation, Persistence: 0.5, Initial: &initial}
+	rates := d.fromShocks([]float64{0, 0, 0})
+	expected := []float64{0.006, 0.004, 0.003}
+	for i := range rates {
+		if !closeTo(rates[i], expected[i], 1e-12) {
+			t.Error("Expected inflation to revert halfway to the mean each month, got", rates)
+			break
+		}
+	}
+
+	d.Initial = nil
+	d.StdDev = 0.001
+	rates = d.fromShocks([]float64{1, 0})
+	if !closeTo(rates[0], 0.003, 1e-12) || !closeTo(rates[1], 0.0025, 1e-12) {
+		t.Error("Expected a shock to carry over into the next month, got", rates)
+	}
+}
+
+func TestIIDInflationIsUnchanged(t *testing.T) {
+	s := validSimulationData()
+	rates := s.inflationRandoms(12, rand.New(rand.NewSource(5)))
+	expected := generateRandomsFromDistribution(rand.New(rand.NewSource(5)), s.Inflation.Distribution, 12)
+	for i := range rates {
+		if rates[i] != expected[i] {
+			t.Error("Expected independent draws by default, got", rates)
+			break
+		}
+	}
+}
+
+func TestCorrelatedInflationUsesLastCholeskyColumn(t *testing.T) {
+	s := validSimulationData()
+	s.Inflation.Correlated = true
+	s.Inflation.StdDev = 0.01
+	// Inflation moves one for one with the first asset class's shock
+	s.CholeskyDecomposition = []float64{
+		1, 0, 0, 0,
+		0.5, 1, 0, 0,
+		0.5, 0.5, 1, 0,
+		1, 0, 0, 0,
+	}
+	if errs := s.Validate(); len(errs) != 0 {
+		t.Fatal("Expected no errors, got", errs)
+	}
+
+	path := lognormalModel{}.Generate(s, 24, rand.New(rand.NewSource(1)))
+	first := s.AssetPerformanceData["CDN-REALESTATE"] // first alphabetically
+	for i, rate := range path.Inflation {
+		shock := (rate - s.Inflation.Mean) / s.Inflation.StdDev
+		firstShock := (math.Log1p(path.Assets["CDN-REALESTATE"][i]) - first.Mean + 0.5*first.StdDev*first.StdDev) / first.StdDev
+		if !closeTo(shock, firstShock, 1e-6) {
+			t.Error("Expected inflation's shock to follow the first asset class's, got", shock, firstShock)
+			break
+		}
+	}
+
+	s.CholeskyDecomposition = s.CholeskyDecomposition[:9]
+	if errs := s.Validate(); !hasValidationError(errs, "cholesky_decomposition", errCodeMismatch) {
+		t.Error("Expected a row and column for inflation to be required, got", errs)
+	}
+}
+
+func TestCorrelatedInflationMatchesInputs(t *testing.T) {
+	s := validSimulationData()
+	s.Inflation.Correlated = true
+	s.Inflation.StdDev = 0.002
+	// Inflation is correlated 0.6 with the first asset class, and not with the
+	// others
+	s.CholeskyDecomposition = []float64{
+		1, 0, 0, 0,
+		0, 1, 0, 0,
+		0, 0, 1, 0,
+		0.6, 0, 0, 0.8,
+	}
+
+	var inflation, firstShocks []float64
+	first := s.AssetPerformanceData["CDN-REALESTATE"] // first alphabetically
+	rng := rand.New(rand.NewSource(3))
+	for trial := 0; trial < 500; trial++ {
+		path := lognormalModel{}.Generate(s, 200, rng)
+		inflation = append(inflation, path.Inflation...)
+		for _, r := range path.Assets["CDN-REALESTATE"] {
+			firstShocks = append(firstShocks, (math.Log1p(r)-first.Mean+0.5*first.StdDev*first.StdDev)/first.StdDev)
+		}
+	}
+	if stdDev := sampleStdDev(inflation); !closeTo(stdDev, 0.002, 0.00004) {
+		t.Error("Expected correlated inflation to keep its std dev, got", stdDev)
+	}
+	if correlation := sampleCorrelation(inflation, firstShocks); !closeTo(correlation, 0.6, 0.02) {
+		t.Error("Expected inflation to be correlated 0.6 with the first asset class, got", correlation)
+	}
+}
+
+func TestValidateInflationModel(t *testing.T) {
+	s := validSimulationData()
+	s.Inflation.Model = ar1Inflation
+	s.Inflation.Persistence = 1
+	if errs := s.Validate(); !hasValidationError(errs, "inflation.persistence", errCodeOutOfRange) {
+		t.Error("Expected persistence of 1 to be invalid, got", errs)
+	}
+
+	s.Inflation.Model = "garch"
+	if errs := s.Validate(); !hasValidationError(errs, "inflation.model", errCodeInvalid) {
+		t.Error("Expected an unknown model to be invalid, got", errs)
+	}
+
+	s = validSimulationData()
+	s.Inflation.Correlated = true
+	s.ReturnModel.Type = bootstrapReturnModel
+	if errs := s.Validate(); !hasValidationError(errs, "inflation.correlated", errCodeInvalid) {
+		t.Error("Expected correlated inflation to need the lognormal model, got", errs)
+	}
+}
@@ -0,0 +1,67 @@
+package simulation
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"time"
+)
+
+// ErrTimeBudgetExceeded is returned by Simulate when a request runs longer than
+// Limits.MaxDuration.
+var ErrTimeBudgetExceeded = errors.New("simulation exceeded its time budget")
+
+// TrialBudgetError is returned by Simulate when a request asks for more trials
+// than Limits.MaxTrials allows.
+type TrialBudgetError struct {
+	Requested int
+	Max       int
+}
+
+func (e *TrialBudgetError) Error() string {
+	return fmt.Sprintf("number_of_trials of %d exceeds the maximum of %d", e.Requested, e.Max)
+}
+
+// Limits bounds the resources a single simulation request may use. Zero values
+// mean "no limit" (or, for Workers, "use GOMAXPROCS").
+type Limits struct {
+	Workers     int
+	MaxTrials   int
+	MaxDuration time.Duration
+}
+
+// DefaultLimits returns a worker pool sized to GOMAXPROCS, with no trial or
+// time budget.
+// Receiver: None
+// Params: None
+// Returns: Limits
+func DefaultLimits() Limits {
+	return Limits{Workers: runtime.GOMAXPROCS(0)}
+}
+
+// workersFor returns how many worker goroutines to start for a given number of
+// chunks of trials - never more than there are chunks to run.
+// Receiver: Limits
+// Params: numberOfChunks int
+// Returns: int
+func (l Limits) workersFor(numberOfChunks int) int {
+	workers := l.Workers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	if workers > numberOfChunks {
+		workers = numberOfChunks
+	}
+	return workers
+}
+
+// checkTrials returns a *TrialBudgetError if numberOfTrials is over budget.
+// Receiver: Limits
+// Params: numberOfTrials int
+// Returns: error
+func (l Limits) checkTrials(numberOfTrials int) error {
+	if l.MaxTrials > 0 && numberOfTrials > l.MaxTrials {
+		return &TrialBudgetError{Requested: numberOfTrials, Max: l.MaxTrials}
+	}
+	return nil
+}
@@ -129,26 +129,26 @@ var mortalityTable = [][]float64{
 
 // maleDiesAt Function for male mortality, delegates to diesAt function
 // Receiver: None
-// Params: age -- int
+// Params: rng -- *rand.Rand, age -- int
 // Returns: bool
-func maleDiesAt(age int) bool {
-	return diesAt("male", age)
+func maleDiesAt(rng *rand.Rand, age int) bool {
+	return diesAt(rng, "male", age)
 }
 
 // femaleDiesAt Function for male mortality, delegates to diesAt function
 // Receiver: None
-// Params: age -- int
+// Params: rng -- *rand.Rand, age -- int
 // Returns: bool
-func femaleDiesAt(age int) bool {
-	return diesAt("female", age)
+func femaleDiesAt(rng *rand.Rand, age int) bool {
+	return diesAt(rng, "female", age)
 }
 
 // diesAt Rand-based function that determines if male/female lives or dies for
 // a given age
 // Receiver: None
-// Params: age -- int
+// Params: rng -- *rand.Rand, gender -- string, age -- int
 // Returns: bool
-func diesAt(gender string, age int) bool {
+func diesAt(rng *rand.Rand, gender string, age int) bool {
 	if age > 120 {
 		return true
 	}
@@ -161,7 +161,7 @@ func diesAt(gender string, age int) bool {
 
 	prob := mortalityTable[age][genderKey]
 
-	if rand.Float64() < prob {
+	if rng.Float64() < prob {
 		return true
 	} else {
 		return false
@@ -6,11 +6,11 @@ import (
 )
 
 func TestReturnsSameValuesMale(t *testing.T) {
-	rand.Seed(42)
+	rng := rand.New(rand.NewSource(42))
 
-	first := maleDiesAt(90)
-	second := maleDiesAt(90)
-	third := maleDiesAt(90)
+	first := maleDiesAt(rng, 90)
+	second := maleDiesAt(rng, 90)
+	third := maleDiesAt(rng, 90)
 
 	if first {
 		t.Error("Was expecting false")
@@ -26,11 +26,11 @@ func TestReturnsSameValuesMale(t *testing.T) {
 }
 
 func TestReturnsSameValuesFemale(t *testing.T) {
-	rand.Seed(42)
+	rng := rand.New(rand.NewSource(42))
 
-	first := femaleDiesAt(90)
-	second := femaleDiesAt(90)
-	third := femaleDiesAt(90)
+	first := femaleDiesAt(rng, 90)
+	second := femaleDiesAt(rng, 90)
+	third := femaleDiesAt(rng, 90)
 
 	if first {
 		t.Error("Was expecting false")
@@ -46,9 +46,10 @@ func TestReturnsSameValuesFemale(t *testing.T) {
 }
 
 func TestAlwaysTrueAt120ForMale(t *testing.T) {
+	rng := rand.New(rand.NewSource(42))
 	allTrue := true
 	for i := 0; i < 100; i++ {
-		maleDies := maleDiesAt(121)
+		maleDies := maleDiesAt(rng, 121)
 		if !maleDies {
 			allTrue = false
 		}
@@ -60,9 +61,10 @@ func TestAlwaysTrueAt120ForMale(t *testing.T) {
 }
 
 func TestAlwaysTrueAt120ForFemale(t *testing.T) {
+	rng := rand.New(rand.NewSource(42))
 	allTrue := true
 	for i := 0; i < 100; i++ {
-		femaleDies := femaleDiesAt(121)
+		femaleDies := femaleDiesAt(rng, 121)
 		if !femaleDies {
 			allTrue = false
 		}
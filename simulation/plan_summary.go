@@ -0,0 +1,207 @@
+package simulation
+
+import "math"
+
+// defaultSummaryPercentiles are reported in the plan summary if the request
+// did not ask for specific percentiles.
+var defaultSummaryPercentiles = []float64{5, 25, 50, 75, 95}
+
+type planSummary struct {
+	// Fraction of trials where assets never went negative while anyone was
+	// alive.
+	ProbabilityOfSuccess float64 `json:"probability_of_success"`
+
+	// When money ran out (only for the trials where it did) - age of the
+	// primary person, and date.
+	RuinAgePercentiles  map[string]float64 `json:"ruin_age_percentiles,omitempty"`
+	RuinDatePercentiles map[string]int     `json:"ruin_date_percentiles,omitempty"`
+
+	// Assets, less any debts owing, at the death of the last survivor (or at
+	// the end of the simulation, if someone is still alive).
+	TerminalWealthMean        float64            `json:"terminal_wealth_mean"`
+	TerminalWealthPercentiles map[string]float64 `json:"terminal_wealth_percentiles"`
+
+	// Fraction of trials leaving more than the legacy target.
+	LegacyTarget        float64 `json:"legacy_target"`
+	ProbabilityOfLegacy float64 `json:"probability_of_legacy"`
+
+	// Total investment fees paid, up to the same point as terminal wealth.
+	// Only present if there are fees.
+	TotalFees *seriesSummary `json:"total_fees,omitempty"`
+
+	// When backtesting, the result from each start month, in order.
+	Backtests []backtestResult `json:"backtests,omitempty"`
+
+	// With the regime_switching model, the regimes each sampled trial went
+	// through, in trial order.
+	RegimePaths []regimePath `json:"regime_paths,omitempty"`
+}
+
+// trialOutcome is the plan-level result of a single trial
+type trialOutcome struct {
+	ranOutOfMoney  bool
+	ruinAge        int // age of the primary person when money ran out
+	ruinPeriod     int // index of the time step money ran out in
+	terminalWealth float64
+	fees           float64 // paid up to the same point as terminal wealth
+	start          string  // when backtesting, label of the start month
+
+	// For trials whose regime path is sampled
+	sampled bool
+	trial   int
+	regimes []regimeSpell
+}
+
+// trialOutcome works out the plan-level result of a single trial from its time
+// steps.
+// Receiver: SimulationData
+// Params: trialResult []simulationTimeStep
+// Returns: trialOutcome
+func (s *SimulationData) trialOutcome(trialResult []simulationTimeStep) trialOutcome {
+	last := trialResult[len(trialResult)-1]
+	outcome := trialOutcome{terminalWealth: last.assets - last.debts, fees: last.fees}
+
+	// Ages in the time steps stop increasing at death, so work the primary
+	// person's age out from their starting age.
+	startingAge := s.primaryAge()
+
+	for monthIndex, step := range trialResult {
+		someoneAlive := step.maleAlive || step.femaleAlive
+		if !someoneAlive {
+			outcome.terminalWealth = step.assets - step.debts
+			outcome.fees = step.fees
+			break
+		}
+		if step.assets < 0 && !outcome.ranOutOfMoney {
+			outcome.ranOutOfMoney = true
+			outcome.ruinAge = startingAge + monthIndex/12
+			outcome.ruinPeriod = monthIndex
+		}
+	}
+
+	return outcome
+}
+
+// planAccumulator keeps running plan-level statistics across trials
+type planAccumulator struct {
+	numberOfTrials int
+	successes      int
+	aboveLegacy    int
+	legacyTarget   float64
+	ruinAges       statAccumulator
+	ruinPeriods    statAccumulator
+	terminalWealth statAccumulator
+	fees           *statAccumulator // nil unless there are fees
+	backtests      []backtestResult
+	regimePaths    []regimePath
+}
+
+// newPlanAccumulator returns an empty accumulator
+// Receiver: None
+// Params: legacyTarget float64
+// Params: fees bool -- whether to track fees paid
+// Returns: planAccumulator
+func newPlanAccumulator(legacyTarget float64, fees bool) planAccumulator {
+	a := planAccumulator{
+		legacyTarget:   legacyTarget,
+		ruinAges:       newStatAccumulator(),
+		ruinPeriods:    newStatAccumulator(),
+		terminalWealth: newStatAccumulator(),
+	}
+	if fees {
+		feesPaid := newStatAccumulator()
+		a.fees = &feesPaid
+	}
+	return a
+}
+
+// addOutcome folds a single trial's outcome into the accumulator
+// Receiver: *planAccumulator
+// Params: outcome trialOutcome
+// Returns: None
+func (a *planAccumulator) addOutcome(outcome trialOutcome) {
+	a.numberOfTrials++
+	if outcome.ranOutOfMoney {
+		a.ruinAges.add(float64(outcome.ruinAge))
+		a.ruinPeriods.add(float64(outcome.ruinPeriod))
+	} else {
+		a.successes++
+	}
+	if outcome.terminalWealth > a.legacyTarget {
+		a.aboveLegacy++
+	}
+	a.terminalWealth.add(outcome.terminalWealth)
+	if a.fees != nil {
+		a.fees.add(outcome.fees)
+	}
+
+	if outcome.start != "" {
+		result := backtestResult{Start: outcome.start, Failed: outcome.ranOutOfMoney, TerminalWealth: outcome.terminalWealth}
+		if outcome.ranOutOfMoney {
+			result.RuinAge = outcome.ruinAge
+		}
+		a.backtests = append(a.backtests, result)
+	}
+	if outcome.sampled {
+		a.regimePaths = append(a.regimePaths, regimePath{
+			Trial:          outcome.trial,
+			Failed:         outcome.ranOutOfMoney,
+			TerminalWealth: outcome.terminalWealth,
+			Regimes:        outcome.regimes,
+		})
+	}
+}
+
+// merge folds another accumulator into this one
+// Receiver: *planAccumulator
+// Params: other *planAccumulator
+// Returns: None
+func (a *planAccumulator) merge(other *planAccumulator) {
+	a.numberOfTrials += other.numberOfTrials
+	a.successes += other.successes
+	a.aboveLegacy += other.aboveLegacy
+	a.ruinAges.merge(&other.ruinAges)
+	a.ruinPeriods.merge(&other.ruinPeriods)
+	a.terminalWealth.merge(&other.terminalWealth)
+	if a.fees != nil {
+		a.fees.merge(other.fees)
+	}
+	a.backtests = append(a.backtests, other.backtests...)
+	a.regimePaths = append(a.regimePaths, other.regimePaths...)
+}
+
+// summarize generates the plan summary
+// Receiver: *planAccumulator
+// Params: percentiles []float64 -- percentiles to report, defaults used if empty
+// Params: dates []int -- date of each period, to convert ruin periods to dates
+// Returns: planSummary
+func (a *planAccumulator) summarize(percentiles []float64, dates []int) planSummary {
+	if len(percentiles) == 0 {
+		percentiles = defaultSummaryPercentiles
+	}
+
+	summary := planSummary{
+		ProbabilityOfSuccess:      float64(a.successes) / float64(a.numberOfTrials),
+		TerminalWealthMean:        a.terminalWealth.mean,
+		TerminalWealthPercentiles: a.terminalWealth.percentiles(percentiles),
+		LegacyTarget:              a.legacyTarget,
+		ProbabilityOfLegacy:       float64(a.aboveLegacy) / float64(a.numberOfTrials),
+		Backtests:                 a.backtests,
+		RegimePaths:               a.regimePaths,
+	}
+
+	if a.fees != nil {
+		fees := a.fees.summarize(percentiles)
+		summary.TotalFees = &fees
+	}
+
+	if a.ruinAges.count > 0 {
+		summary.RuinAgePercentiles = a.ruinAges.percentiles(percentiles)
+		summary.RuinDatePercentiles = make(map[string]int, len(percentiles))
+		for key, period := range a.ruinPeriods.percentiles(percentiles) {
+			summary.RuinDatePercentiles[key] = dates[int(math.Floor(period+0.5))]
+		}
+	}
+
+	return summary
+}
@@ -0,0 +1,65 @@
+package simulation
+
+import "testing"
+
+func TestTrialOutcome(t *testing.T) {
+	s := &SimulationData{Parameters: Parameters{Male: true, Married: false, MaleAge: 60}}
+
+	trialResult := make([]simulationTimeStep, 36)
+	for i := range trialResult {
+		trialResult[i] = simulationTimeStep{assets: 1000 - float64(i)*50, maleAlive: i < 30}
+	}
+
+	outcome := s.trialOutcome(trialResult)
+	if !outcome.ranOutOfMoney {
+		t.Error("Expected to run out of money")
+	}
+	if outcome.ruinPeriod != 21 || outcome.ruinAge != 61 {
+		t.Error("Expected ruin in period 21 at age 61, got", outcome.ruinPeriod, outcome.ruinAge)
+	}
+	if outcome.terminalWealth != -500 {
+		t.Error("Expected terminal wealth at death of -500, got", outcome.terminalWealth)
+	}
+}
+
+func TestTrialOutcomeIgnoresAssetsAfterDeath(t *testing.T) {
+	s := &SimulationData{Parameters: Parameters{Male: false, Married: false, FemaleAge: 80}}
+
+	trialResult := []simulationTimeStep{
+		simulationTimeStep{assets: 500, femaleAlive: true},
+		simulationTimeStep{assets: 250, femaleAlive: false},
+		simulationTimeStep{assets: -10, femaleAlive: false},
+	}
+
+	outcome := s.trialOutcome(trialResult)
+	if outcome.ranOutOfMoney {
+		t.Error("Money running out after death should not count")
+	}
+	if outcome.terminalWealth != 250 {
+		t.Error("Expected terminal wealth of 250, got", outcome.terminalWealth)
+	}
+}
+
+func TestPlanAccumulatorSummarize(t *testing.T) {
+	first := newPlanAccumulator(100, false)
+	second := newPlanAccumulator(100, false)
+	first.addOutcome(trialOutcome{terminalWealth: 500})
+	first.addOutcome(trialOutcome{ranOutOfMoney: true, ruinAge: 85, ruinPeriod: 1, terminalWealth: -20})
+	second.addOutcome(trialOutcome{terminalWealth: 50})
+	second.addOutcome(trialOutcome{terminalWealth: 150})
+	first.merge(&second)
+
+	summary := first.summarize([]float64{50}, []int{10, 20, 30})
+	if summary.ProbabilityOfSuccess != 0.75 {
+		t.Error("Expected success of 0.75, got", summary.ProbabilityOfSuccess)
+	}
+	if summary.ProbabilityOfLegacy != 0.5 {
+		t.Error("Expected legacy probability of 0.5, got", summary.ProbabilityOfLegacy)
+	}
+	if summary.RuinAgePercentiles["50"] != 85 || summary.RuinDatePercentiles["50"] != 20 {
+		t.Error("Unexpected ruin percentiles", summary.RuinAgePercentiles, summary.RuinDatePercentiles)
+	}
+	if summary.TerminalWealthMean != 170 {
+		t.Error("Expected mean terminal wealth of 170, got", summary.TerminalWealthMean)
+	}
+}
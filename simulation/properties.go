@@ -0,0 +1,142 @@
+package simulation
+
+import "math/rand"
+
+// Property is real estate held alongside the portfolio - a home, cottage or
+// rental. Its value grows with its own appreciation, costs are paid and rent
+// received monthly while it's held, and it can be bought or sold during the
+// simulation.
+type Property struct {
+	Id    string  `json:"id"`
+	Value float64 `json:"value"` // today's value
+
+	// Monthly appreciation. Defaults to the real estate distribution (or
+	// history, with the bootstrap model or backtests).
+	Appreciation *Distribution `json:"appreciation"`
+
+	// Property tax, maintenance, insurance etc. - annual percentage of value
+	CarryingCosts float64 `json:"carrying_costs"`
+
+	// Rent less any rental expenses - annual, in today's dollars, indexed to
+	// inflation
+	RentalIncome float64 `json:"rental_income"`
+
+	// Paid for from assets at its appreciated value on the purchase date.
+	// Already owned if there is no purchase date, and never held if it's
+	// after the simulation ends.
+	PurchaseDate int `json:"purchase_date"`
+
+	// Sold on the sale date, less selling costs (percentage of the sale
+	// price). Held to the end if there is no sale date.
+	SaleDate     int     `json:"sale_date"`
+	SellingCosts float64 `json:"selling_costs"`
+}
+
+// propertyMonths is when a property is held - from the purchase month up to
+// (not including) the sale month. Both are the number of months simulated if
+// it's never held.
+type propertyMonths struct {
+	purchase int
+	sale     int
+}
+
+// monthOf returns the index of the time step a date falls in
+// Params: timeSteps []*timeStep
+// Params: date int -- (UTC)
+// Params: otherwise int -- returned if the date is not set, or not simulated
+// Returns: int
+func monthOf(timeSteps []*timeStep, date int, otherwise int) int {
+	if date <= 0 {
+		return otherwise
+	}
+	onDate := Expense{OneTimeOn: date}
+	for monthIndex, step := range timeSteps {
+		if onDate.isRelevantOnetimeDate(step.date) {
+			return monthIndex
+		}
+	}
+	return otherwise
+}
+
+// propertySchedule works out when each property is held. The same for every
+// trial, so it is worked out once.
+// Receiver: SimulationData
+// Params: timeSteps []*timeStep
+// Returns: []propertyMonths -- by property
+func (s *SimulationData) propertySchedule(timeSteps []*timeStep) []propertyMonths {
+	if s.propertyMonths != nil {
+		return s.propertyMonths
+	}
+	schedule := make([]propertyMonths, len(s.Properties))
+	for i, property := range s.Properties {
+		months := propertyMonths{
+			purchase: monthOf(timeSteps, property.PurchaseDate, -1),
+			sale:     monthOf(timeSteps, property.SaleDate, len(timeSteps)),
+		}
+		if months.purchase < 0 {
+			if property.PurchaseDate > timeSteps[0].date {
+				// Bought after the horizon - never held
+				months = propertyMonths{purchase: len(timeSteps), sale: len(timeSteps)}
+			} else {
+				// Already owned
+				months.purchase = 0
+			}
+		}
+		schedule[i] = months
+	}
+	s.propertyMonths = schedule
+	return schedule
+}
+
+// applyProperties values each property through a trial, and adds its cash
+// flows - purchase, carrying costs, rent and sale - to the time steps
+// Receiver: SimulationData
+// Params: trialResult []simulationTimeStep -- inflation already applied
+// Params: timeSteps []*timeStep
+// Params: realEstate returnsList -- the trial's real estate returns
+// Params: rng *rand.Rand -- the trial's random stream
+// Returns: None
+func (s *SimulationData) applyProperties(trialResult []simulationTimeStep, timeSteps []*timeStep, realEstate returnsList, rng *rand.Rand) {
+	for monthIndex := range trialResult {
+		trialResult[monthIndex].propertyValues = make([]float64, len(s.Properties))
+		trialResult[monthIndex].propertyEquity = make([]float64, len(s.Properties))
+	}
+
+	for propertyIndex, months := range s.propertySchedule(timeSteps) {
+		property := &s.Properties[propertyIndex]
+		appreciation := realEstate
+		if property.Appreciation != nil {
+			appreciation = generateRandomsFromDistribution(rng, *property.Appreciation, len(trialResult))
+		}
+
+		value := property.Value
+		for monthIndex := range trialResult {
+			step := &trialResult[monthIndex]
+			switch {
+			case monthIndex == months.sale:
+				step.inflows += value * (1 - property.SellingCosts/100)
+			case monthIndex >= months.purchase && monthIndex < months.sale:
+				if monthIndex == months.purchase && months.purchase > 0 {
+					step.inflows -= value
+				}
+				step.propertyValues[propertyIndex] = value
+				step.propertyEquity[propertyIndex] = value
+				step.inflows += property.RentalIncome*step.inflationFactor/12 - value*property.CarryingCosts/1200
+			}
+			value *= 1 + appreciation[monthIndex]
+		}
+	}
+}
+
+// propertyIndex returns the index of the property with an id
+// Receiver: SimulationData
+// Params: id string
+// Returns: int -- -1 if there is none
+func (s *SimulationData) propertyIndex(id string) int {
+	for i, property := range s.Properties {
+		if property.Id == id {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,161 @@
+package simulation
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+const (
+	jan2015 = 1420070400
+	jan2016 = 1452816000 // Jan 15 2016
+	jan2017 = 1484438400 // Jan 15 2017
+)
+
+// applyTestProperties runs applyProperties (and applyDebts) over a number of
+// months, with flat real estate returns and no inflation
+func applyTestProperties(s *SimulationData, numberOfMonths int, appreciation float64) []simulationTimeStep {
+	trialResult := make([]simulationTimeStep, numberOfMonths)
+	realEstate := make(returnsList, numberOfMonths)
+	for i := range trialResult {
+		trialResult[i].inflationFactor = 1
+		realEstate[i] = appreciation
+	}
+	timeSteps := s.applyExpenses(numberOfMonths)
+	s.applyProperties(trialResult, timeSteps, realEstate, rand.New(rand.NewSource(1)))
+	s.applyDebts(trialResult, timeSteps, make(returnsList, numberOfMonths))
+	return trialResult
+}
+
+func TestMonthOf(t *testing.T) {
+	s := validSimulationData()
+	s.StartDate = jan2015
+	timeSteps := s.applyExpenses(36)
+	if month := monthOf(timeSteps, jan2016, -1); month != 12 {
+		t.Error("Expected January 2016 to be month 12, got", month)
+	}
+	if month := monthOf(timeSteps, 0, -1); month != -1 {
+		t.Error("Expected no date to give the default, got", month)
+	}
+}
+
+func TestPropertySchedulePurchaseAfterHorizon(t *testing.T) {
+	s := validSimulationData()
+	s.StartDate = jan2015
+	s.Parameters.IncludeHome = false
+	s.Properties = []Property{
+		{Id: "owned", Value: 100000},
+		{Id: "retirement", Value: 100000, PurchaseDate: 4102444800}, // 2100
+	}
+	trialResult := applyTestProperties(s, 60, 0.01)
+
+	schedule := s.propertySchedule(s.applyExpenses(60))
+	if schedule[0] != (propertyMonths{0, 60}) || schedule[1] != (propertyMonths{60, 60}) {
+		t.Error("Expected a purchase after the horizon to never be held, got", schedule)
+	}
+	for _, step := range trialResult {
+		if step.propertyValues[1] != 0 || step.propertyEquity[1] != 0 {
+			t.Error("Expected no value before the purchase, got", step.propertyValues, step.propertyEquity)
+			break
+		}
+	}
+}
+
+func TestApplyPropertiesCashFlows(t *testing.T) {
+	s := validSimulationData()
+	s.StartDate = jan2015
+	s.Parameters.IncludeHome = false
+	s.Properties = []Property{{Id: "rental", Value: 100000, CarryingCosts: 1.2, RentalIncome: 6000, SaleDate: jan2016, SellingCosts: 5}}
+	trialResult := applyTestProperties(s, 24, 0.01)
+
+	// 500 rent less 100 of costs in the first month
+	if !closeTo(trialResult[0].inflows, 400, 1e-9) || trialResult[0].propertyValues[0] != 100000 {
+		t.Error("Expected rent less carrying costs while held, got", trialResult[0].inflows, trialResult[0].propertyValues)
+	}
+	saleValue := 100000 * math.Pow(1.01, 12)
+	if !closeTo(trialResult[12].inflows, saleValue*0.95, 1e-6) || trialResult[12].propertyValues[0] != 0 {
+		t.Error("Expected the appreciated value less selling costs at the sale, got", trialResult[12].inflows, saleValue)
+	}
+	if trialResult[13].inflows != 0 {
+		t.Error("Expected no cash flows once sold, got", trialResult[13].inflows)
+	}
+}
+
+func TestApplyPropertiesPurchaseWithMortgage(t *testing.T) {
+	s := validSimulationData()
+	s.StartDate = jan2015
+	s.Parameters.IncludeHome = false
+	s.Properties = []Property{{Id: "cottage", Value: 200000, PurchaseDate: jan2016, SaleDate: jan2017}}
+	s.Debts = []Debt{{Principal: 100000, AmortizationMonths: 100, Property: "cottage"}}
+	trialResult := applyTestProperties(s, 36, 0)
+
+	if trialResult[0].propertyValues[0] != 0 || trialResult[0].inflows != 0 || trialResult[0].debts != 0 || trialResult[0].propertyEquity[0] != 0 {
+		t.Error("Expected nothing before the purchase, got", trialResult[0].propertyValues, trialResult[0].inflows, trialResult[0].debts)
+	}
+	// The mortgage pays for half
+	if trialResult[12].inflows != -100000 || trialResult[12].propertyValues[0] != 200000 {
+		t.Error("Expected the purchase to be paid from assets and the mortgage, got", trialResult[12].inflows)
+	}
+	if trialResult[12].debts != 99000 || trialResult[12].propertyEquity[0] != 200000-99000 {
+		t.Error("Expected the mortgage to start on the purchase and reduce equity, got", trialResult[12].debts, trialResult[12].propertyEquity)
+	}
+	// 100000 less 13 payments of 1000
+	if trialResult[24].inflows != 200000-87000 || trialResult[24].debts != 0 {
+		t.Error("Expected the mortgage paid from the sale, got", trialResult[24].inflows, trialResult[24].debts)
+	}
+}
+
+func TestSimulateWithProperties(t *testing.T) {
+	s := validSimulationData()
+	s.Seed = 4
+	s.Properties = []Property{
+		{Id: "home", Value: 500000, CarryingCosts: 1.5},
+		{Id: "condo", Value: 300000, Appreciation: &Distribution{Mean: 0.002, StdDev: 0.01}, RentalIncome: 18000},
+	}
+	s.Debts = []Debt{{Principal: 200000, Rate: 4, AmortizationMonths: 240, Property: "condo"}}
+	result, err := Simulate(context.Background(), s, DefaultLimits())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	step := result.Timesteps[12]
+	home, condo := step.Properties["home"], step.Properties["condo"]
+	if home.Value.Mean <= 0 || home.Equity.Mean != home.Value.Mean {
+		t.Error("Expected an unmortgaged home's equity to be its value, got", home)
+	}
+	if !closeTo(condo.Equity.Mean, condo.Value.Mean-step.Debts.Mean, 1e-6) {
+		t.Error("Expected the condo's equity to be net of its mortgage, got", condo)
+	}
+	if !closeTo(step.NetWorth.Mean, step.AssetsMean+home.Value.Mean+condo.Value.Mean-step.Debts.Mean, 1e-6) {
+		t.Error("Expected net worth to include the properties, got", step.NetWorth.Mean)
+	}
+}
+
+func TestValidateProperties(t *testing.T) {
+	s := validSimulationData()
+	s.Properties = []Property{
+		{Id: "home", Value: -1, CarryingCosts: 101, PurchaseDate: jan2017, SaleDate: jan2016},
+		{Id: "home", Appreciation: &Distribution{StdDev: -0.1}},
+	}
+	s.Debts = []Debt{{Principal: 1000, AmortizationMonths: 12, Property: "barn"}}
+	errs := s.Validate()
+	if !hasValidationError(errs, "properties[0].value", errCodeOutOfRange) {
+		t.Error("Expected a negative value to be invalid, got", errs)
+	}
+	if !hasValidationError(errs, "properties[0].carrying_costs", errCodeOutOfRange) {
+		t.Error("Expected carrying costs over 100% to be invalid, got", errs)
+	}
+	if !hasValidationError(errs, "properties[0].sale_date", errCodeOutOfRange) {
+		t.Error("Expected a sale before the purchase to be invalid, got", errs)
+	}
+	if !hasValidationError(errs, "properties[1].id", errCodeInvalid) {
+		t.Error("Expected a repeated id to be invalid, got", errs)
+	}
+	if !hasValidationError(errs, "properties[1].appreciation.std_dev", errCodeOutOfRange) {
+		t.Error("Expected a negative std dev to be invalid, got", errs)
+	}
+	if !hasValidationError(errs, "debts[0].property", errCodeMismatch) {
+		t.Error("Expected a debt against an unknown property to be invalid, got", errs)
+	}
+}
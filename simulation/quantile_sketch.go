@@ -0,0 +1,170 @@
+package simulation
+
+import (
+	"math"
+	"sort"
+)
+
+// sketchCompression bounds the number of centroids a quantileSketch keeps
+// (roughly 2x this value). Higher is more accurate, but uses more memory -
+// remember there is a sketch per series per period.
+const sketchCompression = 50
+
+// sketchBufferSize is how many raw values are collected before they are folded
+// into the centroids.
+const sketchBufferSize = 100
+
+type centroid struct {
+	mean   float64
+	weight float64
+}
+
+type centroidList []centroid
+
+// quantileSketch is a small merging t-digest. It estimates quantiles of a
+// stream of values in bounded memory, and two sketches can be merged, so each
+// worker can keep its own and combine them at the end. Centroids are small
+// (accurate) near the tails and large in the middle of the distribution.
+type quantileSketch struct {
+	centroids centroidList // sorted by mean
+	buffer    []float64    // values not yet folded into centroids
+	count     float64
+	min       float64
+	max       float64
+}
+
+// newQuantileSketch returns an empty sketch
+// Receiver: None
+// Params: None
+// Returns: *quantileSketch
+func newQuantileSketch() *quantileSketch {
+	return &quantileSketch{
+		min: math.Inf(1),
+		max: math.Inf(-1),
+	}
+}
+
+// add records a single value
+// Receiver: *quantileSketch
+// Params: x float64
+// Returns: None
+func (q *quantileSketch) add(x float64) {
+	q.buffer = append(q.buffer, x)
+	q.count++
+	q.min = math.Min(q.min, x)
+	q.max = math.Max(q.max, x)
+	if len(q.buffer) >= sketchBufferSize {
+		q.compress()
+	}
+}
+
+// merge folds another sketch into this one. The other sketch is compressed as a
+// side effect but is otherwise unchanged.
+// Receiver: *quantileSketch
+// Params: other *quantileSketch
+// Returns: None
+func (q *quantileSketch) merge(other *quantileSketch) {
+	if other.count == 0 {
+		return
+	}
+	other.compress()
+	q.compress()
+	q.count += other.count
+	q.min = math.Min(q.min, other.min)
+	q.max = math.Max(q.max, other.max)
+	q.combine(q.centroids, other.centroids)
+}
+
+// compress folds any buffered values into the centroids
+// Receiver: *quantileSketch
+// Params: None
+// Returns: None
+func (q *quantileSketch) compress() {
+	if len(q.buffer) == 0 {
+		return
+	}
+	sort.Float64s(q.buffer)
+	buffered := make(centroidList, len(q.buffer))
+	for i, x := range q.buffer {
+		buffered[i] = centroid{mean: x, weight: 1}
+	}
+	q.buffer = q.buffer[:0]
+	q.combine(q.centroids, buffered)
+}
+
+// combine merges two sorted lists of centroids, then greedily combines
+// neighbours as long as the combined centroid stays within the t-digest size
+// bound (4 * n * q * (1 - q) / compression) at its quantile. The result replaces
+// the sketch's centroids.
+// Receiver: *quantileSketch
+// Params: a, b centroidList -- each sorted by mean
+// Returns: None
+func (q *quantileSketch) combine(a, b centroidList) {
+	all := make(centroidList, 0, len(a)+len(b))
+	totalWeight := 0.0
+	for len(a) > 0 || len(b) > 0 {
+		var next centroid
+		if len(b) == 0 || (len(a) > 0 && a[0].mean <= b[0].mean) {
+			next, a = a[0], a[1:]
+		} else {
+			next, b = b[0], b[1:]
+		}
+		all = append(all, next)
+		totalWeight += next.weight
+	}
+
+	result := make(centroidList, 0, 2*sketchCompression)
+	current := all[0]
+	weightSoFar := 0.0
+	for _, next := range all[1:] {
+		combined := current.weight + next.weight
+		position := (weightSoFar + combined/2) / totalWeight
+		if combined <= 4*totalWeight*position*(1-position)/sketchCompression {
+			current.mean += (next.mean - current.mean) * next.weight / combined
+			current.weight = combined
+			continue
+		}
+		result = append(result, current)
+		weightSoFar += current.weight
+		current = next
+	}
+	q.centroids = append(result, current)
+}
+
+// quantile estimates the value at quantile p by interpolating between the
+// centres of neighbouring centroids.
+// Receiver: *quantileSketch
+// Params: p float64 -- 0 - 1
+// Returns: float64
+func (q *quantileSketch) quantile(p float64) float64 {
+	q.compress()
+	if q.count == 0 {
+		return 0
+	}
+	if len(q.centroids) == 1 {
+		return q.centroids[0].mean
+	}
+
+	target := p * q.count
+	first := q.centroids[0]
+	if target < first.weight/2 {
+		return q.min + (first.mean-q.min)*target/(first.weight/2)
+	}
+
+	position := first.weight / 2 // weight up to the centre of the centroid
+	for i := 1; i < len(q.centroids); i++ {
+		previous, next := q.centroids[i-1], q.centroids[i]
+		step := (previous.weight + next.weight) / 2
+		if target < position+step {
+			return previous.mean + (next.mean-previous.mean)*(target-position)/step
+		}
+		position += step
+	}
+
+	last := q.centroids[len(q.centroids)-1]
+	remaining := q.count - position
+	if remaining <= 0 {
+		return q.max
+	}
+	return last.mean + (q.max-last.mean)*math.Min((target-position)/remaining, 1)
+}
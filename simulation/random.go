@@ -0,0 +1,45 @@
+package simulation
+
+import (
+	"math/rand"
+	"time"
+)
+
+// newSeed picks a seed for requests that did not provide one. The seed is
+// echoed back in the response so the result can be reproduced later.
+// Receiver: None
+// Params: None
+// Returns: int64 (never zero)
+func newSeed() int64 {
+	seed := time.Now().UnixNano()
+	if seed == 0 {
+		seed = 1
+	}
+	return seed
+}
+
+// trialRand returns an independent random stream for a single trial. Each
+// trial gets its own *rand.Rand (rather than sharing the global, locked,
+// source) so results do not depend on the order goroutines are scheduled in.
+// Receiver: None
+// Params: seed int64 -- the request seed
+// Params: trial int -- index of the trial
+// Returns: *rand.Rand
+func trialRand(seed int64, trial int) *rand.Rand {
+	return rand.New(rand.NewSource(trialSeed(seed, trial)))
+}
+
+// trialSeed derives a per-trial seed from the request seed and trial index.
+// Neighbouring (seed, trial) pairs are run through the splitmix64 finalizer so
+// they produce unrelated streams.
+// Receiver: None
+// Params: seed int64 -- the request seed
+// Params: trial int -- index of the trial
+// Returns: int64
+func trialSeed(seed int64, trial int) int64 {
+	z := uint64(seed) + uint64(trial+1)*0x9e3779b97f4a7c15
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	z = z ^ (z >> 31)
+	return int64(z)
+}
@@ -0,0 +1,181 @@
+package simulation
+
+import "math"
+
+// RebalancingPolicy sets when accounts are brought back to their portfolio
+// weights. Between rebalances, each asset class's holding grows with its own
+// returns, so the weights drift.
+type RebalancingPolicy struct {
+	// "monthly" (default), "quarterly", "annual", "bands" or "never"
+	Type string `json:"type"`
+
+	// bands - how far (percentage points) any asset class's weight can drift
+	// from its target before the account is rebalanced. Defaults to 5.
+	Tolerance float64 `json:"tolerance"`
+
+	// Percentage of the value bought and sold that is lost to costs when
+	// rebalancing
+	TransactionCost float64 `json:"transaction_cost"`
+}
+
+// rebalancingTypes are the policies that can be chosen by name
+var rebalancingTypes = []string{"monthly", "quarterly", "annual", "bands", "never"}
+
+// rebalancingPeriods is the number of months between calendar rebalances
+var rebalancingPeriods = map[string]int{"": 1, "monthly": 1, "quarterly": 3, "annual": 12}
+
+// tracksHoldings Determines if holdings need to be tracked by asset class. If
+// accounts are rebalanced monthly at no cost, each account simply earns its
+// portfolio's weighted return.
+// Receiver: RebalancingPolicy
+// Params: None
+// Returns: bool
+func (p *RebalancingPolicy) tracksHoldings() bool {
+	return rebalancingPeriods[p.Type] != 1 || p.TransactionCost != 0
+}
+
+// holdings is an account's investments, by asset class, through a trial
+type holdings struct {
+	returns []returnsList // by asset class held
+	targets []float64     // target weights, by asset class held
+	values  []float64     // current value, by asset class held
+	glide   [][]float64   // if following the glide path, target weights by month
+
+	expenseRatios []float64 // monthly, by asset class held
+}
+
+// newHoldings returns an account's holdings, invested at its target weights
+// Receiver: SimulationData
+// Params: account *Account
+// Params: assetPerformance returnResultsByAsset
+// Params: balance float64 -- starting balance
+// Returns: *holdings
+func (s *SimulationData) newHoldings(account *Account, assetPerformance returnResultsByAsset, balance float64) *holdings {
+	h := &holdings{}
+	if account.usesGlidePath(s) {
+		// Every asset class, in assetClassIds() order, as the glide path's
+		// weights are
+		h.glide = s.glidePathWeights(len(assetPerformance[s.assetClassIds()[0]]))
+		h.targets = h.glide[0]
+		for _, assetClassId := range s.assetClassIds() {
+			h.returns = append(h.returns, assetPerformance[assetClassId])
+			h.expenseRatios = append(h.expenseRatios, s.Fees.ExpenseRatios[assetClassId]/1200)
+		}
+	} else {
+		weights := account.portfolioWeights(s)
+		for _, assetClassId := range s.assetClassIds() {
+			weight, ok := weights[assetClassId]
+			if !ok {
+				continue // not held in this portfolio
+			}
+			h.returns = append(h.returns, assetPerformance[assetClassId])
+			h.targets = append(h.targets, weight)
+			h.expenseRatios = append(h.expenseRatios, s.Fees.ExpenseRatios[assetClassId]/1200)
+		}
+	}
+	h.values = make([]float64, len(h.targets))
+	h.invest(balance)
+	return h
+}
+
+// total returns the value of all the holdings
+// Receiver: *holdings
+// Params: None
+// Returns: float64
+func (h *holdings) total() float64 {
+	total := 0.0
+	for _, value := range h.values {
+		total += value
+	}
+	return total
+}
+
+// invest sets the holdings to their target weights of a balance
+// Receiver: *holdings
+// Params: balance float64
+// Returns: None
+func (h *holdings) invest(balance float64) {
+	for i, target := range h.targets {
+		h.values[i] = target * balance
+	}
+}
+
+// grow applies a month's returns to each holding
+// Receiver: *holdings
+// Params: monthIndex int
+// Returns: float64 -- gains
+func (h *holdings) grow(monthIndex int) float64 {
+	gains := 0.0
+	for i := range h.values {
+		gain := h.values[i] * h.returns[i][monthIndex]
+		h.values[i] += gain
+		gains += gain
+	}
+	return gains
+}
+
+// settle brings the holdings in line with the account's balance after the
+// month's cash flows - deposits are invested at the target weights, and
+// withdrawals sold in proportion to the holdings - then rebalances if the
+// policy says to. Targets move with the glide path, if following one.
+// Receiver: *holdings
+// Params: balance float64 -- the account's balance after cash flows
+// Params: policy *RebalancingPolicy
+// Params: monthIndex int
+// Returns: float64 -- the balance after any rebalancing costs
+func (h *holdings) settle(balance float64, policy *RebalancingPolicy, monthIndex int) float64 {
+	if h.glide != nil {
+		h.targets = h.glide[monthIndex]
+	}
+	total := h.total()
+	flow := balance - total
+	switch {
+	case total <= 0:
+		h.invest(balance)
+	case flow > 0:
+		for i, target := range h.targets {
+			h.values[i] += target * flow
+		}
+	case flow < 0:
+		for i := range h.values {
+			h.values[i] *= balance / total
+		}
+	}
+
+	if !h.rebalanceDue(policy, monthIndex, balance) {
+		return balance
+	}
+	traded := 0.0
+	for i, target := range h.targets {
+		traded += math.Abs(target*balance - h.values[i])
+	}
+	balance -= traded * policy.TransactionCost / 100
+	h.invest(balance)
+	return balance
+}
+
+// rebalanceDue Determines if the holdings should be rebalanced at the end of a
+// month
+// Receiver: *holdings
+// Params: policy *RebalancingPolicy
+// Params: monthIndex int
+// Params: balance float64
+// Returns: bool
+func (h *holdings) rebalanceDue(policy *RebalancingPolicy, monthIndex int, balance float64) bool {
+	if balance <= 0 {
+		return false
+	}
+	switch policy.Type {
+	case "never":
+		return false
+	case "bands":
+		tolerance := orDefault(policy.Tolerance, 5) / 100
+		for i, target := range h.targets {
+			if math.Abs(h.values[i]/balance-target) > tolerance {
+				return true
+			}
+		}
+		return false
+	}
+	return (monthIndex+1)%rebalancingPeriods[policy.Type] == 0
+}
@@ -0,0 +1,114 @@
+package simulation
+
+import (
+	"context"
+	"testing"
+)
+
+// driftingHoldings returns holdings split 50/50 between an asset that doubles
+// every month and one that is flat
+func driftingHoldings(balance float64) *holdings {
+	return &holdings{
+		returns: []returnsList{{1, 1, 1, 1}, {0, 0, 0, 0}},
+		targets: []float64{0.5, 0.5},
+		values:  []float64{balance / 2, balance / 2},
+	}
+}
+
+func TestHoldingsDriftWithoutRebalancing(t *testing.T) {
+	h := driftingHoldings(100)
+	policy := &RebalancingPolicy{Type: "never"}
+	balance := 100.0
+	for m := 0; m < 2; m++ {
+		balance += h.grow(m)
+		balance = h.settle(balance, policy, m)
+	}
+	if balance != 250 || h.values[0] != 200 || h.values[1] != 50 {
+		t.Error("Expected the growing asset to take over, got", balance, h.values)
+	}
+}
+
+func TestHoldingsRebalanceOnCalendar(t *testing.T) {
+	h := driftingHoldings(100)
+	policy := &RebalancingPolicy{Type: "quarterly"}
+	balance := 100.0
+	for m := 0; m < 3; m++ {
+		balance += h.grow(m)
+		balance = h.settle(balance, policy, m)
+		if m < 2 && h.values[0] == h.values[1] {
+			t.Error("Expected no rebalance before the end of the quarter at", m)
+		}
+	}
+	if h.values[0] != h.values[1] || h.values[0] != balance/2 {
+		t.Error("Expected a rebalance at the end of the quarter, got", h.values)
+	}
+}
+
+func TestHoldingsRebalanceOutsideBandsWithCosts(t *testing.T) {
+	h := &holdings{
+		returns: []returnsList{{0.05, 0.2}, {0, 0}},
+		targets: []float64{0.5, 0.5},
+		values:  []float64{50, 50},
+	}
+	policy := &RebalancingPolicy{Type: "bands", Tolerance: 5, TransactionCost: 1}
+
+	balance := 100 + h.grow(0)
+	balance = h.settle(balance, policy, 0)
+	if balance != 102.5 || h.values[0] != 52.5 {
+		t.Error("Expected no rebalance within the band, got", h.values)
+	}
+
+	balance += h.grow(1) // 63 / 50
+	balance = h.settle(balance, policy, 1)
+	// Sells 6.5 and buys 6.5, costing 1% of 13
+	if !closeTo(balance, 113-0.13, 1e-9) || !closeTo(h.values[0], balance/2, 1e-9) {
+		t.Error("Expected a rebalance less costs once outside the band, got", balance, h.values)
+	}
+}
+
+func TestHoldingsSettleCashFlows(t *testing.T) {
+	h := &holdings{targets: []float64{0.5, 0.5}, values: []float64{80, 20}}
+	policy := &RebalancingPolicy{Type: "never"}
+
+	h.settle(120, policy, 0)
+	if h.values[0] != 90 || h.values[1] != 30 {
+		t.Error("Expected deposits invested at the target weights, got", h.values)
+	}
+	h.settle(60, policy, 1)
+	if h.values[0] != 45 || h.values[1] != 15 {
+		t.Error("Expected withdrawals sold in proportion to the holdings, got", h.values)
+	}
+}
+
+func TestSimulateWithAnnualRebalancing(t *testing.T) {
+	s := validSimulationData()
+	s.Seed = 11
+	expected, _ := Simulate(context.Background(), s, DefaultLimits())
+
+	s = validSimulationData()
+	s.Seed = 11
+	s.Rebalancing = RebalancingPolicy{Type: "annual"}
+	annual, err := Simulate(context.Background(), s, DefaultLimits())
+	if err != nil {
+		t.Fatal(err)
+	}
+	last := len(expected.Timesteps) - 1
+	if annual.Timesteps[last].AssetsMean == expected.Timesteps[last].AssetsMean {
+		t.Error("Expected drift between annual rebalances to change the results")
+	}
+	if !closeTo(annual.Timesteps[1].AssetsMean, expected.Timesteps[1].AssetsMean, 1e-6) {
+		t.Error("Expected the same results before any drift compounds, got", annual.Timesteps[1].AssetsMean, expected.Timesteps[1].AssetsMean)
+	}
+}
+
+func TestValidateRebalancing(t *testing.T) {
+	s := validSimulationData()
+	s.Rebalancing = RebalancingPolicy{Type: "weekly", TransactionCost: -1}
+	errs := s.Validate()
+	if !hasValidationError(errs, "rebalancing.type", errCodeInvalid) {
+		t.Error("Expected an unknown policy to be invalid, got", errs)
+	}
+	if !hasValidationError(errs, "rebalancing.transaction_cost", errCodeOutOfRange) {
+		t.Error("Expected a negative cost to be invalid, got", errs)
+	}
+}
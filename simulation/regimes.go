@@ -0,0 +1,157 @@
+package simulation
+
+import (
+	"math"
+	"math/rand"
+
+	goMatrix "github.com/skelterjohn/go.matrix"
+)
+
+// regimeSwitchingReturnModel draws each month's asset returns from the
+// distributions of the market regime (e.g. bull or bear) it is in
+const regimeSwitchingReturnModel = "regime_switching"
+
+// Regime is one state of the market, with its own asset class distributions
+// and correlations
+type Regime struct {
+	Name                  string                  `json:"name"`
+	AssetPerformanceData  map[string]Distribution `json:"asset_performance_data"`
+	CholeskyDecomposition []float64               `json:"cholesky_decomposition"`
+}
+
+// regimeSpell is a run of consecutive months spent in one regime
+type regimeSpell struct {
+	Regime string `json:"regime"`
+	Start  int    `json:"start"` // index of the first month
+	Months int    `json:"months"`
+}
+
+// regimePath is the regimes a sampled trial went through, with its outcome
+type regimePath struct {
+	Trial          int           `json:"trial"`
+	Failed         bool          `json:"failed"`
+	TerminalWealth float64       `json:"terminal_wealth"`
+	Regimes        []regimeSpell `json:"regimes"`
+}
+
+func init() {
+	RegisterReturnModel(regimeSwitchingReturnModel, newRegimeSwitchingModel)
+}
+
+// regimeSwitchingModel is a Markov chain over the regimes - each month the
+// regime changes according to the transition matrix, then correlated returns
+// are drawn as in the lognormal model, using that regime's distributions.
+// Inflation and real estate don't depend on the regime.
+type regimeSwitchingModel struct {
+	initialRegime int
+	transitions   [][]float64 // cumulative probabilities, by current regime
+	distributions [][]Distribution
+	cholesky      []*goMatrix.DenseMatrix
+}
+
+// newRegimeSwitchingModel returns a regime switching model for a simulation
+// Params: s *SimulationData
+// Returns: ReturnModel
+func newRegimeSwitchingModel(s *SimulationData) ReturnModel {
+	settings := s.ReturnModel
+	assetClassIds := s.assetClassIds()
+	m := regimeSwitchingModel{initialRegime: settings.InitialRegime}
+
+	for i, regime := range settings.Regimes {
+		distributions := make([]Distribution, len(assetClassIds))
+		for column, assetClassId := range assetClassIds {
+			distributions[column] = regime.AssetPerformanceData[assetClassId]
+		}
+		m.distributions = append(m.distributions, distributions)
+
+		size := int(math.Sqrt(float64(len(regime.CholeskyDecomposition))))
+		m.cholesky = append(m.cholesky, goMatrix.MakeDenseMatrix(unitCholeskyRows(regime.CholeskyDecomposition), size, size))
+
+		cumulative := make([]float64, len(settings.Regimes))
+		total := 0.0
+		for j := range cumulative {
+			if i < len(settings.Transitions) && j < len(settings.Transitions[i]) {
+				total += settings.Transitions[i][j]
+			}
+			cumulative[j] = total
+		}
+		m.transitions = append(m.transitions, cumulative)
+	}
+	return m
+}
+
+// Generate generates performance results for real estate, inflation and each
+// asset class, recording the regime each month was in
+// Receiver: regimeSwitchingModel
+// Params: s *SimulationData
+// Params: numberOfMonths int -- number of periods to model
+// Params: rng *rand.Rand -- the trial's random stream
+// Returns: MarketPath
+func (m regimeSwitchingModel) Generate(s *SimulationData, numberOfMonths int, rng *rand.Rand) MarketPath {
+	assetClassIds := s.assetClassIds()
+	path := MarketPath{
+		RealEstate: s.realEstateRandoms(numberOfMonths, rng),
+		Inflation:  s.inflationRandoms(numberOfMonths, rng),
+		Assets:     make(returnResultsByAsset, len(assetClassIds)),
+		Regimes:    make([]int, numberOfMonths),
+	}
+	for _, assetClassId := range assetClassIds {
+		path.Assets[assetClassId] = make(returnsList, numberOfMonths)
+	}
+
+	shocks := make([]float64, len(assetClassIds))
+	correlated := make([]float64, len(assetClassIds))
+	regime := m.initialRegime
+	for monthIndex := 0; monthIndex < numberOfMonths; monthIndex++ {
+		if monthIndex > 0 {
+			regime = m.nextRegime(regime, rng)
+		}
+		path.Regimes[monthIndex] = regime
+
+		distributions := m.distributions[regime]
+		for column := range shocks {
+			shocks[column] = distributions[column].shock(rng)
+		}
+		correlateShocks(m.cholesky[regime], shocks, correlated)
+
+		// Same lognormal step as generateReturns
+		for column, assetClassId := range assetClassIds {
+			d := distributions[column]
+			logReturn := d.Mean - 0.5*d.StdDev*d.StdDev + d.StdDev*correlated[column]
+			path.Assets[assetClassId][monthIndex] = math.Exp(logReturn) - 1
+		}
+	}
+	return path
+}
+
+// nextRegime draws the regime for the next month
+// Receiver: regimeSwitchingModel
+// Params: regime int -- current regime
+// Params: rng *rand.Rand
+// Returns: int
+func (m regimeSwitchingModel) nextRegime(regime int, rng *rand.Rand) int {
+	u := rng.Float64()
+	for next, cumulative := range m.transitions[regime] {
+		if u < cumulative {
+			return next
+		}
+	}
+	return regime // rows sum to slightly less than 1
+}
+
+// regimeSpells summarizes the regimes a trial went through as runs of months
+// Receiver: SimulationData
+// Params: trialResult []simulationTimeStep
+// Returns: []regimeSpell
+func (s *SimulationData) regimeSpells(trialResult []simulationTimeStep) []regimeSpell {
+	var spells []regimeSpell
+	for monthIndex, step := range trialResult {
+		name := s.ReturnModel.Regimes[step.regime].Name
+		if len(spells) > 0 && spells[len(spells)-1].Regime == name {
+			spells[len(spells)-1].Months++
+			continue
+		}
+		spells = append(spells, regimeSpell{Regime: name, Start: monthIndex, Months: 1})
+	}
+	return spells
+}
@@ -0,0 +1,140 @@
+package simulation
+
+import (
+	"context"
+	"math/rand"
+	"testing"
+)
+
+// regimeSimulationData returns data using a bull and a bear regime
+func regimeSimulationData(transitions [][]float64) *SimulationData {
+	regime := func(name string, mean float64) Regime {
+		return Regime{
+			Name: name,
+			AssetPerformanceData: map[string]Distribution{
+				"INTL-BOND":      Distribution{Mean: mean, StdDev: 0.01},
+				"US-REALESTATE":  Distribution{Mean: mean, StdDev: 0.02},
+				"CDN-REALESTATE": Distribution{Mean: mean, StdDev: 0.03},
+			},
+			CholeskyDecomposition: []float64{1, 0, 0, 0.5, 0.866, 0, 0.3, 0.2, 0.93},
+		}
+	}
+
+	s := validSimulationData()
+	s.ReturnModel = ReturnModelSettings{
+		Type:        regimeSwitchingReturnModel,
+		Regimes:     []Regime{regime("bull", 0.01), regime("bear", -0.02)},
+		Transitions: transitions,
+	}
+	return s
+}
+
+func TestRegimeSwitchingFollowsTransitions(t *testing.T) {
+	s := regimeSimulationData([][]float64{{0, 1}, {1, 0}})
+	path := newRegimeSwitchingModel(s).Generate(s, 24, rand.New(rand.NewSource(1)))
+	for m, regime := range path.Regimes {
+		if regime != m%2 {
+			t.Fatal("Expected the regimes to alternate, got", path.Regimes)
+		}
+	}
+
+	s = regimeSimulationData([][]float64{{0.9, 0.1}, {0, 1}})
+	s.ReturnModel.InitialRegime = 1
+	path = newRegimeSwitchingModel(s).Generate(s, 24, rand.New(rand.NewSource(1)))
+	for _, regime := range path.Regimes {
+		if regime != 1 {
+			t.Fatal("Expected to stay in the absorbing regime, got", path.Regimes)
+		}
+	}
+}
+
+func TestRegimeSwitchingUsesRegimeDistributions(t *testing.T) {
+	s := regimeSimulationData([][]float64{{1, 0}, {0, 1}})
+	bull := newRegimeSwitchingModel(s).Generate(s, 5000, rand.New(rand.NewSource(1)))
+	s.ReturnModel.InitialRegime = 1
+	bear := newRegimeSwitchingModel(s).Generate(s, 5000, rand.New(rand.NewSource(1)))
+
+	average := func(returns returnsList) float64 {
+		sum := 0.0
+		for _, r := range returns {
+			sum += r
+		}
+		return sum / float64(len(returns))
+	}
+	if b := average(bull.Assets["INTL-BOND"]); !closeTo(b, 0.01, 0.001) {
+		t.Error("Expected bull returns to average 1% a month, got", b)
+	}
+	if b := average(bear.Assets["INTL-BOND"]); !closeTo(b, -0.02, 0.001) {
+		t.Error("Expected bear returns to average -2% a month, got", b)
+	}
+}
+
+func TestSimulateReturnsSampledRegimePaths(t *testing.T) {
+	s := regimeSimulationData([][]float64{{0.95, 0.05}, {0.2, 0.8}})
+	s.ReturnModel.SampleRegimePaths = 3
+	s.CholeskyDecomposition = nil
+	s.AssetPerformanceData = nil
+	if errs := s.Validate(); len(errs) != 0 {
+		t.Fatal("Expected no errors, got", errs)
+	}
+
+	results, err := Simulate(context.Background(), s, DefaultLimits())
+	if err != nil {
+		t.Fatal(err)
+	}
+	paths := results.Summary.RegimePaths
+	if len(paths) != 3 {
+		t.Fatal("Expected 3 sampled paths, got", len(paths))
+	}
+	for i, path := range paths {
+		if path.Trial != i {
+			t.Error("Expected paths in trial order, got", path.Trial)
+		}
+		months := 0
+		for _, spell := range path.Regimes {
+			if spell.Start != months {
+				t.Error("Expected spells to follow each other, got", path.Regimes)
+				break
+			}
+			months += spell.Months
+		}
+		if months != numberOfMonthsToSimulate(s) {
+			t.Error("Expected spells to cover every month, got", months)
+		}
+	}
+
+	results, _ = Simulate(context.Background(), validSimulationData(), DefaultLimits())
+	if results.Summary.RegimePaths != nil {
+		t.Error("Expected no regime paths from other models")
+	}
+}
+
+func TestValidateRegimes(t *testing.T) {
+	s := regimeSimulationData([][]float64{{0.5, 0.6}, {1}})
+	s.ReturnModel.Regimes[1].Name = "bull"
+	delete(s.ReturnModel.Regimes[1].AssetPerformanceData, "INTL-BOND")
+	s.ReturnModel.Regimes[1].CholeskyDecomposition = []float64{1}
+	s.ReturnModel.InitialRegime = 2
+	s.ReturnModel.SampleRegimePaths = -1
+
+	errs := s.Validate()
+	expected := []struct{ field, code string }{
+		{"return_model.regimes[1].name", errCodeInvalid},
+		{"return_model.regimes[1].asset_performance_data.INTL-BOND", errCodeUnknownAsset},
+		{"return_model.regimes[1].cholesky_decomposition", errCodeMismatch},
+		{"return_model.transitions[0]", errCodeInvalid},
+		{"return_model.transitions[1]", errCodeMismatch},
+		{"return_model.initial_regime", errCodeOutOfRange},
+		{"return_model.sample_regime_paths", errCodeOutOfRange},
+	}
+	for _, e := range expected {
+		if !hasValidationError(errs, e.field, e.code) {
+			t.Error("Expected", e.code, "error for", e.field, "got", errs)
+		}
+	}
+
+	s.ReturnModel.Regimes = s.ReturnModel.Regimes[:1]
+	if errs := s.Validate(); !hasValidationError(errs, "return_model.regimes", errCodeRequired) {
+		t.Error("Expected at least two regimes to be required, got", errs)
+	}
+}
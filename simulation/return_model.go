@@ -0,0 +1,122 @@
+package simulation
+
+import (
+	"math/rand"
+	"sort"
+)
+
+// ReturnModel generates the market returns for a single trial. Models must
+// only draw random numbers from the rng they are given, so results are
+// reproducible from the seed, and must be safe to use from several workers at
+// once.
+type ReturnModel interface {
+	// Generate returns monthly returns for every asset class in the selected
+	// portfolio, inflation and real estate, each numberOfMonths long.
+	Generate(s *SimulationData, numberOfMonths int, rng *rand.Rand) MarketPath
+}
+
+// ReturnModelFactory builds a model for a simulation. Called once per
+// simulation, before any trials are run.
+type ReturnModelFactory func(s *SimulationData) ReturnModel
+
+// ReturnModelSettings selects the return model
+type ReturnModelSettings struct {
+	Type string `json:"type"` // a registered model, "lognormal" by default
+
+	// bootstrap - months resampled at a time (default 12), and the history to
+	// resample. Defaults to the history loaded at server startup.
+	BlockLength int            `json:"block_length"`
+	History     *ReturnHistory `json:"history"`
+
+	// regime_switching - the regimes, and the monthly probability of moving
+	// from each regime (row) to each regime (column). Trials start in the
+	// initial regime. The regime path of the first sample_regime_paths trials
+	// is returned in the summary.
+	Regimes           []Regime    `json:"regimes"`
+	Transitions       [][]float64 `json:"transitions"`
+	InitialRegime     int         `json:"initial_regime"`
+	SampleRegimePaths int         `json:"sample_regime_paths"`
+}
+
+// defaultReturnModel is used if no model is selected
+const defaultReturnModel = "lognormal"
+
+// returnModels are the models that can be selected by name
+var returnModels = map[string]ReturnModelFactory{
+	defaultReturnModel: func(s *SimulationData) ReturnModel { return lognormalModel{} },
+}
+
+// RegisterReturnModel makes a return model available to select by name,
+// replacing any existing model with that name. Not safe to call while
+// simulations are running - register models at startup.
+// Params: name string
+// Params: factory ReturnModelFactory
+// Returns: None
+func RegisterReturnModel(name string, factory ReturnModelFactory) {
+	returnModels[name] = factory
+}
+
+// returnModelNames returns the names of the registered models, sorted
+// Params: None
+// Returns: []string
+func returnModelNames() []string {
+	names := make([]string, 0, len(returnModels))
+	for name := range returnModels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// name returns the selected model, or the default if none was selected
+// Receiver: ReturnModelSettings
+// Params: None
+// Returns: string
+func (r ReturnModelSettings) name() string {
+	if r.Type == "" {
+		return defaultReturnModel
+	}
+	return r.Type
+}
+
+// returnModel returns the model to generate returns with, building it from the
+// selected factory the first time. Tests can set s.model to inject their own.
+// Receiver: *SimulationData
+// Params: None
+// Returns: ReturnModel
+func (s *SimulationData) returnModel() ReturnModel {
+	if s.model == nil {
+		s.model = returnModels[s.ReturnModel.name()](s)
+	}
+	return s.model
+}
+
+// lognormalModel is the default model - normally distributed monthly returns
+// for each asset class, correlated with the cholesky decomposition, and
+// normal inflation (correlated with the asset classes, if asked) and real
+// estate returns.
+type lognormalModel struct{}
+
+// Generate generates performance results for real estate, inflation and each
+// asset class
+// Receiver: lognormalModel
+// Params: s *SimulationData
+// Params: numberOfMonths int -- number of periods to model
+// Params: rng *rand.Rand -- the trial's random stream
+// Returns: MarketPath
+func (lognormalModel) Generate(s *SimulationData, numberOfMonths int, rng *rand.Rand) MarketPath {
+	path := MarketPath{RealEstate: s.realEstateRandoms(numberOfMonths, rng)}
+	if !s.Inflation.Correlated {
+		path.Inflation = s.inflationRandoms(numberOfMonths, rng)
+	}
+
+	choleskyApplied := s.applyCholeskyDecomposition(numberOfMonths, rng)
+	path.Assets = s.generateReturns(numberOfMonths, choleskyApplied)
+
+	if s.Inflation.Correlated {
+		// The last column of the cholesky decomposition is inflation's
+		shocks := choleskyApplied.GetColVector(choleskyApplied.Cols() - 1).Array()
+		path.Inflation = s.Inflation.fromShocks(shocks)
+	}
+	return path
+}
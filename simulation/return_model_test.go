@@ -0,0 +1,70 @@
+package simulation
+
+import (
+	"context"
+	"math/rand"
+	"sync/atomic"
+	"testing"
+)
+
+// flatModel returns the same monthly return for every asset, with no
+// inflation or real estate growth, and counts the trials it generates
+type flatModel struct {
+	rate  float64
+	calls *int64
+}
+
+func (f flatModel) Generate(s *SimulationData, numberOfMonths int, rng *rand.Rand) MarketPath {
+	if f.calls != nil {
+		atomic.AddInt64(f.calls, 1)
+	}
+	path := MarketPath{
+		RealEstate: make(returnsList, numberOfMonths),
+		Inflation:  make(returnsList, numberOfMonths),
+		Assets:     returnResultsByAsset{},
+	}
+	for assetId := range s.SelectedPortfolioWeights {
+		returns := make(returnsList, numberOfMonths)
+		for i := range returns {
+			returns[i] = f.rate
+		}
+		path.Assets[assetId] = returns
+	}
+	return path
+}
+
+func TestSimulateUsesInjectedReturnModel(t *testing.T) {
+	var calls int64
+	s := validSimulationData()
+	s.model = flatModel{rate: 0.01, calls: &calls}
+
+	if _, err := Simulate(context.Background(), s, DefaultLimits()); err != nil {
+		t.Fatal(err)
+	}
+	if calls != int64(s.NumberOfTrials) {
+		t.Error("Expected the injected model to generate every trial, got", calls)
+	}
+}
+
+func TestRegisterReturnModel(t *testing.T) {
+	RegisterReturnModel("flat", func(s *SimulationData) ReturnModel { return flatModel{} })
+	defer delete(returnModels, "flat")
+
+	s := validSimulationData()
+	s.ReturnModel.Type = "flat"
+	if _, ok := s.returnModel().(flatModel); !ok {
+		t.Error("Expected the registered model to be selected")
+	}
+	if errs := s.Validate(); len(errs) != 0 {
+		t.Error("Expected a registered model to be valid, got", errs)
+	}
+
+	s = validSimulationData()
+	if _, ok := s.returnModel().(lognormalModel); !ok {
+		t.Error("Expected the lognormal model by default")
+	}
+	s.ReturnModel.Type = "unknown"
+	if errs := s.Validate(); !hasValidationError(errs, "return_model.type", errCodeInvalid) {
+		t.Error("Expected an unknown model to be invalid, got", errs)
+	}
+}
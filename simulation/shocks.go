@@ -0,0 +1,81 @@
+package simulation
+
+import (
+	"math"
+	"math/rand"
+)
+
+// Shapes of the random shocks a Distribution can draw. Every shape is
+// standardized to a mean of 0 and a standard deviation of 1 before it is
+// scaled, so the distribution's mean and std_dev still hold.
+const (
+	normalShock     = "normal"      // default
+	studentTShock   = "student_t"   // fat tails, set by degrees_of_freedom
+	skewNormalShock = "skew_normal" // asymmetric, set by skew
+)
+
+// shockTypes are the shock shapes that can be chosen by name
+var shockTypes = []string{normalShock, studentTShock, skewNormalShock}
+
+// defaultDegreesOfFreedom is used by student_t shocks if none are given
+const defaultDegreesOfFreedom = 5
+
+// shock draws a single standardized shock
+// Receiver: Distribution
+// Params: rng *rand.Rand -- the trial's random stream
+// Returns: float64
+func (d *Distribution) shock(rng *rand.Rand) float64 {
+	switch d.Shock {
+	case studentTShock:
+		return studentT(rng, orDefault(d.DegreesOfFreedom, defaultDegreesOfFreedom))
+	case skewNormalShock:
+		return skewNormal(rng, d.Skew)
+	}
+	return rng.NormFloat64()
+}
+
+// studentT draws from a Student's t distribution, scaled to unit variance
+// Params: rng *rand.Rand
+// Params: degreesOfFreedom float64 -- must be greater than 2
+// Returns: float64
+func studentT(rng *rand.Rand, degreesOfFreedom float64) float64 {
+	// t = Z / sqrt(V / v), with V chi-squared with v degrees of freedom, has
+	// a variance of v / (v - 2).
+	chiSquared := 2 * gammaVariate(rng, degreesOfFreedom/2)
+	t := rng.NormFloat64() / math.Sqrt(chiSquared/degreesOfFreedom)
+	return t * math.Sqrt((degreesOfFreedom-2)/degreesOfFreedom)
+}
+
+// skewNormal draws from a skew-normal distribution, standardized to a mean of
+// 0 and unit variance
+// Params: rng *rand.Rand
+// Params: shape float64 -- alpha; negative for a longer left tail, 0 for normal
+// Returns: float64
+func skewNormal(rng *rand.Rand, shape float64) float64 {
+	delta := shape / math.Sqrt(1+shape*shape)
+	x := delta*math.Abs(rng.NormFloat64()) + math.Sqrt(1-delta*delta)*rng.NormFloat64()
+
+	mean := delta * math.Sqrt(2/math.Pi)
+	return (x - mean) / math.Sqrt(1-mean*mean)
+}
+
+// gammaVariate draws from a gamma distribution with a scale of 1, using
+// Marsaglia and Tsang's method
+// Params: rng *rand.Rand
+// Params: shape float64 -- must be at least 1
+// Returns: float64
+func gammaVariate(rng *rand.Rand, shape float64) float64 {
+	d := shape - 1.0/3
+	c := 1 / math.Sqrt(9*d)
+	for {
+		x := rng.NormFloat64()
+		v := 1 + c*x
+		if v <= 0 {
+			continue
+		}
+		v = v * v * v
+		if math.Log(rng.Float64()) < 0.5*x*x+d-d*v+d*math.Log(v) {
+			return d * v
+		}
+	}
+}
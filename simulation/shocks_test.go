@@ -0,0 +1,199 @@
+package simulation
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// shockMoments draws shocks and returns their mean, variance, skewness and
+// excess kurtosis
+func shockMoments(d Distribution, n int) (mean, variance, skewness, kurtosis float64) {
+	rng := rand.New(rand.NewSource(7))
+	draws := make([]float64, n)
+	for i := range draws {
+		draws[i] = d.shock(rng)
+		mean += draws[i]
+	}
+	mean /= float64(n)
+	var m3, m4 float64
+	for _, x := range draws {
+		diff := x - mean
+		variance += diff * diff
+		m3 += diff * diff * diff
+		m4 += diff * diff * diff * diff
+	}
+	variance /= float64(n)
+	skewness = m3 / float64(n) / math.Pow(variance, 1.5)
+	kurtosis = m4/float64(n)/(variance*variance) - 3
+	return
+}
+
+func TestShocksAreStandardized(t *testing.T) {
+	for _, d := range []Distribution{
+		Distribution{},
+		Distribution{Shock: studentTShock, DegreesOfFreedom: 6},
+		Distribution{Shock: skewNormalShock, Skew: -4},
+	} {
+		mean, variance, _, _ := shockMoments(d, 200000)
+		if !closeTo(mean, 0, 0.01) || !closeTo(variance, 1, 0.03) {
+			t.Error("Expected a mean of 0 and variance of 1 for", d.Shock, "got", mean, variance)
+		}
+	}
+}
+
+func TestShockShapes(t *testing.T) {
+	if _, _, _, kurtosis := shockMoments(Distribution{Shock: studentTShock, DegreesOfFreedom: 6}, 200000); kurtosis < 1.5 {
+		t.Error("Expected fat tails from student_t shocks, got excess kurtosis", kurtosis)
+	}
+	if _, _, skewness, _ := shockMoments(Distribution{Shock: skewNormalShock, Skew: -4}, 200000); skewness > -0.5 {
+		t.Error("Expected a longer left tail from skew_normal shocks, got skewness", skewness)
+	}
+}
+
+func TestGeneratedReturnsKeepMeanAndStdDev(t *testing.T) {
+	d := Distribution{Mean: 0.005, StdDev: 0.02, Shock: studentTShock, DegreesOfFreedom: 4}
+	returns := generateRandomsFromDistribution(rand.New(rand.NewSource(3)), d, 200000)
+	mean, variance := 0.0, 0.0
+	for _, r := range returns {
+		mean += r
+	}
+	mean /= float64(len(returns))
+	for _, r := range returns {
+		variance += (r - mean) * (r - mean)
+	}
+	stdDev := math.Sqrt(variance / float64(len(returns)))
+	if !closeTo(mean, 0.005, 0.0005) || !closeTo(stdDev, 0.02, 0.001) {
+		t.Error("Expected the distribution's mean and std dev, got", mean, stdDev)
+	}
+}
+
+// sampleStdDev returns the standard deviation of a sample
+func sampleStdDev(xs []float64) float64 {
+	mean, variance := 0.0, 0.0
+	for _, x := range xs {
+		mean += x
+	}
+	mean /= float64(len(xs))
+	for _, x := range xs {
+		variance += (x - mean) * (x - mean)
+	}
+	return math.Sqrt(variance / float64(len(xs)))
+}
+
+// sampleCorrelation returns the correlation between two samples
+func sampleCorrelation(xs, ys []float64) float64 {
+	var meanX, meanY float64
+	for i := range xs {
+		meanX += xs[i]
+		meanY += ys[i]
+	}
+	meanX /= float64(len(xs))
+	meanY /= float64(len(ys))
+	var covariance float64
+	for i := range xs {
+		covariance += (xs[i] - meanX) * (ys[i] - meanY)
+	}
+	covariance /= float64(len(xs))
+	return covariance / (sampleStdDev(xs) * sampleStdDev(ys))
+}
+
+// logReturns converts simple returns back to log returns
+func logReturns(returns returnsList) []float64 {
+	logs := make([]float64, len(returns))
+	for i, r := range returns {
+		logs[i] = math.Log1p(r)
+	}
+	return logs
+}
+
+// generatedLogReturns returns each selected asset class's log returns from
+// many shorter paths, as prices compound over a path
+func generatedLogReturns(model ReturnModel, s *SimulationData) map[string][]float64 {
+	returns := map[string][]float64{}
+	rng := rand.New(rand.NewSource(11))
+	for trial := 0; trial < 1000; trial++ {
+		path := model.Generate(s, 200, rng)
+		for _, id := range s.assetClassIds() {
+			returns[id] = append(returns[id], logReturns(path.Assets[id])...)
+		}
+	}
+	return returns
+}
+
+// checkGeneratedStdDevs checks log returns have their distributions' std devs
+func checkGeneratedStdDevs(t *testing.T, distributions map[string]Distribution, returns map[string][]float64) {
+	for id, generated := range returns {
+		d := distributions[id]
+		if stdDev := sampleStdDev(generated); !closeTo(stdDev, d.StdDev, d.StdDev*0.03) {
+			t.Error("Expected", id, "to keep its std dev of", d.StdDev, "got", stdDev)
+		}
+	}
+}
+
+func TestCorrelatedReturnsKeepStdDev(t *testing.T) {
+	s := validSimulationData()
+	s.AssetPerformanceData = map[string]Distribution{
+		"A": Distribution{Mean: 0.005, StdDev: 0.04},
+		"B": Distribution{Mean: 0.003, StdDev: 0.02, Shock: studentTShock, DegreesOfFreedom: 6},
+		"C": Distribution{Mean: 0.002, StdDev: 0.01},
+	}
+	s.SelectedPortfolioWeights = map[string]float64{"A": 0.4, "B": 0.4, "C": 0.2}
+	// Correlations of 0.5 between A and B, 0.3 between A and C and 0.2
+	// between B and C
+	b2 := math.Sqrt(0.75)
+	c2 := (0.2 - 0.5*0.3) / b2
+	s.CholeskyDecomposition = []float64{
+		1, 0, 0,
+		0.5, b2, 0,
+		0.3, c2, math.Sqrt(1 - 0.3*0.3 - c2*c2),
+	}
+
+	returns := generatedLogReturns(lognormalModel{}, s)
+	checkGeneratedStdDevs(t, s.AssetPerformanceData, returns)
+	a, b, c := returns["A"], returns["B"], returns["C"]
+	if correlation := sampleCorrelation(a, b); !closeTo(correlation, 0.5, 0.02) {
+		t.Error("Expected A and B to be correlated 0.5, got", correlation)
+	}
+	if correlation := sampleCorrelation(b, c); !closeTo(correlation, 0.2, 0.02) {
+		t.Error("Expected B and C to be correlated 0.2, got", correlation)
+	}
+}
+
+func TestCovarianceScaleCholeskyKeepsStdDev(t *testing.T) {
+	// The sim-profiler's payload - cholesky_decomposition is sent at
+	// covariance scale
+	s := validSimulationData()
+	s.CholeskyDecomposition = []float64{0.0576625891, 0, 0, 0, 0, 0.0062658019, 0.0175730542, 0, 0, 0, 0.0056351399, 0.0051007659, 0.0031372137, 0, 0, -0.0046404388, 0.0058461108, 0.0015728539, 0.005015221, 0, 0.054254316, -0.0004589824, 0.0001774192, 0.0012348558, 0.0121795492}
+	s.AssetPerformanceData = map[string]Distribution{
+		"US-MED-GOV-BOND":  Distribution{Mean: 0.0064879833, StdDev: 0.0136574658},
+		"US-SMCAP-STOCK":   Distribution{Mean: 0.005830665, StdDev: 0.0585631555},
+		"CDN-LONG-BOND":    Distribution{Mean: 0.0059680241, StdDev: 0.0576625891},
+		"INTL-BOND":        Distribution{Mean: 0.006604477, StdDev: 0.0216913127},
+		"US-MED-CORP-BOND": Distribution{Mean: 0.0063501862, StdDev: 0.0138674297},
+	}
+	s.SelectedPortfolioWeights = map[string]float64{"CDN-LONG-BOND": 0, "INTL-BOND": 0.491, "US-MED-CORP-BOND": 0.1608, "US-MED-GOV-BOND": 0.3483, "US-SMCAP-STOCK": 0}
+	checkGeneratedStdDevs(t, s.AssetPerformanceData, generatedLogReturns(lognormalModel{}, s))
+
+	// And the test fixture's
+	s = validSimulationData()
+	checkGeneratedStdDevs(t, s.AssetPerformanceData, generatedLogReturns(lognormalModel{}, s))
+
+	// And a regime's
+	s = regimeSimulationData([][]float64{{1, 0}, {0, 1}})
+	s.ReturnModel.Regimes[0].CholeskyDecomposition = validSimulationData().CholeskyDecomposition
+	checkGeneratedStdDevs(t, s.ReturnModel.Regimes[0].AssetPerformanceData, generatedLogReturns(newRegimeSwitchingModel(s), s))
+}
+
+func TestValidateShocks(t *testing.T) {
+	s := validSimulationData()
+	s.Inflation.Shock = "cauchy"
+	s.AssetPerformanceData["INTL-BOND"] = Distribution{Mean: 0.0003, StdDev: 0.0002, Shock: studentTShock, DegreesOfFreedom: 2}
+	errs := s.Validate()
+	if !hasValidationError(errs, "inflation.shock", errCodeInvalid) {
+		t.Error("Expected an unknown shock to be invalid, got", errs)
+	}
+	if !hasValidationError(errs, "asset_performance_data.INTL-BOND.degrees_of_freedom", errCodeOutOfRange) {
+		t.Error("Expected infinite variance to be invalid, got", errs)
+	}
+}
@@ -4,11 +4,12 @@
 package simulation
 
 import (
+	"context"
 	"encoding/json"
 	"io"
 	"log"
-	"math"
 	"net/http"
+	"sync"
 
 	goStats "github.com/GaryBoone/GoStats/stats"
 	"github.com/kr/pretty"
@@ -19,32 +20,20 @@ type ApiResponse struct {
 	StatusCode int
 }
 
-type simulationResponse []summarizedTimeStep
-
-type summarizedTimeStep struct {
-	AssetsMean   float64 `json:"assets_mean"`
-	AssetsCILow  float64 `json:"assets_ci_low"`
-	AssetsCIHigh float64 `json:"assets_ci_high"`
-
-	IncomeMean   float64 `json:"income_mean"`
-	IncomeCILow  float64 `json:"income_ci_low"`
-	IncomeCIHigh float64 `json:"income_ci_high"`
-
-	ExpensesMean   float64 `json:"expenses_mean"`
-	ExpensesCILow  float64 `json:"expenses_ci_low"`
-	ExpensesCIHigh float64 `json:"expenses_ci_high"`
-
-	OutOfMoneyPercentage float64 `json:"out_of_money_percentage"`
-	DateInt              int     `json:"date"`
+type simulationResponse struct {
+	Timesteps []summarizedTimeStep
+	Summary   planSummary
 }
 
 // ValidateAndHandleJsonInput is the main entry point into this package for the
-// API server (i.e. given a POST'ed JSON body). It loads JSON into struct and
-// essentially just calls the Simulate() method.
+// API server (i.e. given a POST'ed JSON body). It loads JSON into struct,
+// validates it, and essentially just calls the Simulate() method.
 // Receiver: None
+// Params: ctx context.Context -- cancelled when the client goes away
 // Params: j io.ReadCloser (via r.Body)
+// Params: limits Limits -- worker pool size and trial/time budget
 // Returns: ApiResponse {Response/StatusCode}
-func ValidateAndHandleJsonInput(j io.ReadCloser) ApiResponse {
+func ValidateAndHandleJsonInput(ctx context.Context, j io.ReadCloser, limits Limits) ApiResponse {
 	decoder := json.NewDecoder(j)
 
 	var simulationData SimulationData
@@ -60,150 +49,215 @@ func ValidateAndHandleJsonInput(j io.ReadCloser) ApiResponse {
 		}
 	}
 
+	validationErrors := simulationData.Validate()
+	if len(validationErrors) > 0 {
+		return ApiResponse{
+			Response: map[string]interface{}{
+				"success": false,
+				"message": "Invalid simulation data.",
+				"errors":  validationErrors,
+			},
+			StatusCode: http.StatusUnprocessableEntity,
+		}
+	}
+
 	log.Printf("%# v", pretty.Formatter(simulationData))
-	resp := Simulate(&simulationData)
+	resp, err := Simulate(ctx, &simulationData, limits)
+	if err != nil {
+		return errorResponse(err)
+	}
 
 	return ApiResponse{
 		Response: map[string]interface{}{
 			"success":   true,
-			"timesteps": resp,
+			"seed":      simulationData.Seed,
+			"timesteps": resp.Timesteps,
+			"summary":   resp.Summary,
 		},
 		StatusCode: http.StatusOK,
 	}
 }
 
+// errorResponse maps an error from Simulate to an ApiResponse.
+// Receiver: None
+// Params: err error
+// Returns: ApiResponse {Response/StatusCode}
+func errorResponse(err error) ApiResponse {
+	statusCode := http.StatusServiceUnavailable
+	if _, ok := err.(*TrialBudgetError); ok {
+		statusCode = http.StatusUnprocessableEntity
+	}
+
+	return ApiResponse{
+		Response: map[string]interface{}{
+			"success": false,
+			"message": err.Error(),
+		},
+		StatusCode: statusCode,
+	}
+}
+
 // Simulate is the main call for simulations - it runs all of the trials, munges
-// data, etc.
+// data, etc. If no seed was provided, one is picked and stored on s so the
+// caller can report it.
 // Receiver: None
+// Params: ctx context.Context -- stops the simulation early when cancelled
 // Params: s *SimulationData
-// Returns: simulationResponse ([]summarizedTimeStep)
-func Simulate(s *SimulationData) simulationResponse {
-	detailedResults := runSimulations(s)
-	summarizedResults := summarizeResults(detailedResults)
-	return summarizedResults
+// Params: limits Limits -- worker pool size and trial/time budget
+// Returns: simulationResponse {Timesteps/Summary}, error
+func Simulate(ctx context.Context, s *SimulationData, limits Limits) (simulationResponse, error) {
+	if s.backtesting() {
+		s.NumberOfTrials = s.backtestStarts(numberOfMonthsToSimulate(s))
+	}
+	if err := limits.checkTrials(s.NumberOfTrials); err != nil {
+		return simulationResponse{}, err
+	}
+	if s.Seed == 0 {
+		s.Seed = newSeed()
+	}
+	results, err := runSimulations(ctx, s, limits)
+	if err != nil {
+		return simulationResponse{}, err
+	}
+	return simulationResponse{
+		Timesteps: results.summarize(s.Percentiles),
+		Summary:   results.plan.summarize(s.Percentiles, results.dates()),
+	}, nil
+}
+
+// trialsPerChunk is how many trials a worker runs (and summarizes) at a time.
+// Chunks are merged in order, so this - and not the number of workers -
+// determines the order floating point values are combined in.
+const trialsPerChunk = 200
+
+type summarizedChunk struct {
+	index       int
+	accumulator *summaryAccumulator
 }
 
-// runSimulations Gathers invididual trial results, as passes detailed data up
-// to be summarized.
+// runSimulations runs the trials and summarizes them as they finish. Trials
+// are run in chunks by a fixed pool of workers; each chunk is folded into its
+// own accumulator, and chunk accumulators are merged in order. Each trial draws
+// from its own random stream derived from the seed, so results are the same
+// however the trials are scheduled.
 // Receiver: None
+// Params: ctx context.Context -- stops the trials when cancelled
 // Params: s *SimulationData
-// Returns: [][]simulationTimeStep
-func runSimulations(s *SimulationData) [][]simulationTimeStep {
+// Params: limits Limits -- worker pool size and time budget
+// Returns: *summaryAccumulator, error
+func runSimulations(ctx context.Context, s *SimulationData, limits Limits) (*summaryAccumulator, error) {
+	if limits.MaxDuration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, limits.MaxDuration)
+		defer cancel()
+	}
+
 	numberOfTrials := s.NumberOfTrials
 	numberOfMonths := numberOfMonthsToSimulate(s)
-	results := make([][]simulationTimeStep, numberOfTrials)
+	numberOfChunks := (numberOfTrials + trialsPerChunk - 1) / trialsPerChunk
 
 	// This does not change trial-to-trial, do only once.
 	timeSteps := s.applyExpenses(numberOfMonths)
-
-	type empty struct{}
-	notifier := make(chan empty, numberOfTrials)
-	for trial := 0; trial < numberOfTrials; trial++ {
-		go func(i int) {
-			results[i] = s.runIndividualSimulation(timeSteps, numberOfMonths)
-			notifier <- empty{}
-		}(trial)
+	if s.Tax.enabled() {
+		s.Tax.prepare()
 	}
-
-	// Wait for goroutines to finish
-	for i := 0; i < numberOfTrials; i++ {
-		<-notifier
+	s.returnModel() // build before the workers share it
+	s.choleskyValues()
+	if s.GlidePath.enabled() {
+		s.glidePathWeights(numberOfMonths)
+	}
+	if len(s.Properties) > 0 {
+		s.propertySchedule(timeSteps)
 	}
 
-	return results
-}
-
-// summarizeResults Summarizes results / generates descriptive statistics so we
-// don't have to send tens of thousands of trials down to the client.
-// Receiver: None
-// Params: detailedData -- [][]simulationTimeStep)
-// Returns: []summarizedTimeStep
-func summarizeResults(detailedData [][]simulationTimeStep) []summarizedTimeStep {
-	numberOfTrials := len(detailedData)
-	numberOfPeriods := len(detailedData[0])
-
-	// Prep the slice
-	summarizedResults := make([]summarizedTimeStep, numberOfPeriods)
-
-	for period := 0; period < numberOfPeriods; period++ {
-
-		outOfMoneyOccurences := 0.0                // initialize value
-		dateInt := detailedData[0][period].dateInt // same in every trial
-
-		/* 	Transpose the arrays so that we have a list of asset/income/expense
-		results by period, instead of by trial. */
-
-		periodAssetResults := make([]float64, numberOfTrials)
-		periodIncomeResults := make([]float64, numberOfTrials)
-		periodExpensesResults := make([]float64, numberOfTrials)
-
-		for trialIndex, arrayOfTrialResults := range detailedData {
-			periodAssetResults[trialIndex] = arrayOfTrialResults[period].assets
-			periodIncomeResults[trialIndex] = arrayOfTrialResults[period].income
-			periodExpensesResults[trialIndex] = arrayOfTrialResults[period].expenses
-
-			if arrayOfTrialResults[period].assets < 0 {
-				outOfMoneyOccurences++
+	// Hand out chunks until done, or until the request is cancelled / out of
+	// time.
+	chunks := make(chan int)
+	go func() {
+		defer close(chunks)
+		for chunk := 0; chunk < numberOfChunks; chunk++ {
+			select {
+			case chunks <- chunk:
+			case <-ctx.Done():
+				return
 			}
 		}
+	}()
+
+	finished := make(chan summarizedChunk)
+	var wg sync.WaitGroup
+	for worker := 0; worker < limits.workersFor(numberOfChunks); worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for chunk := range chunks {
+				accumulator := newSummaryAccumulator(s, numberOfMonths)
+				for i := chunk * trialsPerChunk; i < (chunk+1)*trialsPerChunk && i < numberOfTrials; i++ {
+					if ctx.Err() != nil {
+						break
+					}
+					trialResult := s.runIndividualSimulation(timeSteps, numberOfMonths, i, trialRand(s.Seed, i))
+					accumulator.addTrial(trialResult)
+					outcome := s.trialOutcome(trialResult)
+					if s.backtesting() {
+						outcome.start = s.backtestLabel(i)
+					}
+					if s.ReturnModel.name() == regimeSwitchingReturnModel && i < s.ReturnModel.SampleRegimePaths {
+						outcome.sampled = true
+						outcome.trial = i
+						outcome.regimes = s.regimeSpells(trialResult)
+					}
+					accumulator.addOutcome(outcome)
+				}
+				if ctx.Err() != nil {
+					continue
+				}
+				finished <- summarizedChunk{index: chunk, accumulator: accumulator}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(finished)
+	}()
+
+	// Merge chunks in order. Chunks that finish early wait in pending.
+	results := newSummaryAccumulator(s, numberOfMonths)
+	pending := map[int]*summaryAccumulator{}
+	nextChunk := 0
+	for chunk := range finished {
+		pending[chunk.index] = chunk.accumulator
+		for accumulator, ok := pending[nextChunk]; ok; accumulator, ok = pending[nextChunk] {
+			results.merge(accumulator)
+			delete(pending, nextChunk)
+			nextChunk++
+		}
+	}
 
-		/* */
-
-		/* Generate descriptive statistics for each period */
-
-		outOfMoneyPercentage := outOfMoneyOccurences / float64(numberOfTrials)
-
-		assetsMean := goStats.StatsMean(periodAssetResults)
-		assetsStdDev := goStats.StatsSampleStandardDeviation(periodAssetResults)
-		assetsCIFactor := 1.96 * assetsStdDev / math.Pow(float64(numberOfTrials), 0.5)
-
-		incomeMean := goStats.StatsMean(periodIncomeResults)
-		incomeStdDev := goStats.StatsSampleStandardDeviation(periodIncomeResults)
-		incomeCIFactor := 1.96 * incomeStdDev / math.Pow(float64(numberOfTrials), 0.5)
-
-		expensesMean := goStats.StatsMean(periodExpensesResults)
-		expensesStdDev := goStats.StatsSampleStandardDeviation(periodExpensesResults)
-		expensesCIFactor := 1.96 * expensesStdDev / math.Pow(float64(numberOfTrials), 0.5)
-
-		/* */
-
-		// // Remove asset results where all dead? Old code -- would need fixing
-		// allDead := false
-		// for index, entry := range meanIncome {
-		// 	if entry == 0 || meanExpenses[index] == 0 {
-		// 		allDead = true
-		// 	}
-		// 	if allDead {
-		// 		meanAssets[index] = 0
-		// 	}
-		// }
-
-		summarizedResults[period] = summarizedTimeStep{
-			AssetsMean:   assetsMean,
-			AssetsCILow:  assetsMean - assetsCIFactor,
-			AssetsCIHigh: assetsMean + assetsCIFactor,
-
-			IncomeMean:   incomeMean,
-			IncomeCILow:  incomeMean - incomeCIFactor,
-			IncomeCIHigh: incomeMean + incomeCIFactor,
-
-			ExpensesMean:   expensesMean,
-			ExpensesCILow:  expensesMean - expensesCIFactor,
-			ExpensesCIHigh: expensesMean + expensesCIFactor,
-
-			OutOfMoneyPercentage: outOfMoneyPercentage,
-			DateInt:              dateInt,
+	if nextChunk < numberOfChunks {
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, ErrTimeBudgetExceeded
 		}
+		return nil, ctx.Err()
 	}
 
-	return summarizedResults
+	return results, nil
 }
 
 // numberOfMonthsToSimulate determines the number of months the simulation must
-// cover, based on the user's ages.
+// cover, based on the requested horizon and the user's ages.
 // Params: s -- *SimulationData
 // Returns: integer
 func numberOfMonthsToSimulate(s *SimulationData) int {
+	switch s.Horizon.Type {
+	case "years":
+		return s.Horizon.Value * 12
+	case "age":
+		return (s.Horizon.Value - s.primaryAge()) * 12
+	}
+
+	// Until the last survivor dies - i.e. until the youngest reaches the end
+	// of the mortality table.
 	male := s.Parameters.MaleAge
 	female := s.Parameters.FemaleAge
 
@@ -219,3 +273,15 @@ func numberOfMonthsToSimulate(s *SimulationData) int {
 
 	return yearsToRun * 12
 }
+
+// primaryAge returns the starting age of the primary person (the male if
+// Parameters.Male, otherwise the female).
+// Receiver: SimulationData
+// Params: None
+// Returns: int
+func (s *SimulationData) primaryAge() int {
+	if s.Parameters.Male {
+		return s.Parameters.MaleAge
+	}
+	return s.Parameters.FemaleAge
+}
@@ -1,14 +1,39 @@
 package simulation
 
+import "math/rand"
+
 type SimulationData struct {
-	NumberOfTrials           int                     `json:"number_of_trials"`
-	CholeskyDecomposition    []float64               `json:"cholesky_decomposition"`
-	Inflation                Distribution            `json:"inflation"`
-	RealEstate               Distribution            `json:"real_estate"`
-	AssetPerformanceData     map[string]Distribution `json:"asset_performance_data"`
-	Parameters               Parameters              `json:"simulation_parameters"`
-	Expenses                 []Expense               `json:"expenses"`
-	SelectedPortfolioWeights map[string]float64      `json:"selected_portfolio_weights"`
+	Seed                  int64                   `json:"seed"`
+	Mode                  string                  `json:"mode"` // "monte_carlo" (default) or "backtest"
+	StartDate             int                     `json:"start_date"`
+	Horizon               Horizon                 `json:"horizon"`
+	NumberOfTrials        int                     `json:"number_of_trials"`
+	CholeskyDecomposition []float64               `json:"cholesky_decomposition"`
+	CorrelationMatrix     *CorrelationMatrix      `json:"correlation_matrix"` // instead of cholesky_decomposition
+	Inflation             InflationDistribution   `json:"inflation"`
+	RealEstate            Distribution            `json:"real_estate"`
+	AssetPerformanceData  map[string]Distribution `json:"asset_performance_data"`
+	Parameters            Parameters              `json:"simulation_parameters"`
+	Expenses              []Expense               `json:"expenses"`
+	Accounts              []Account               `json:"accounts"`
+	WithdrawalStrategy    WithdrawalStrategy      `json:"withdrawal_strategy"`
+	SpendingPolicy        SpendingPolicy          `json:"spending_policy"`
+	Tax                   TaxSettings             `json:"tax"`
+	IncomeStreams         []IncomeStream          `json:"income_streams"`
+	ReturnModel           ReturnModelSettings     `json:"return_model"`
+	Rebalancing           RebalancingPolicy       `json:"rebalancing"`
+	GlidePath             GlidePath               `json:"glide_path"`
+	Fees                  Fees                    `json:"fees"`
+	Debts                 []Debt                  `json:"debts"`
+	Properties            []Property              `json:"properties"`
+
+	model                    ReturnModel        // built from ReturnModel, see returnModel()
+	cholesky                 []float64          // decomposed from CorrelationMatrix, see choleskyValues()
+	glideWeights             [][]float64        // worked out from GlidePath, see glidePathWeights()
+	propertyMonths           []propertyMonths   // worked out from Properties, see propertySchedule()
+	SelectedPortfolioWeights map[string]float64 `json:"selected_portfolio_weights"`
+	Percentiles              []float64          `json:"percentiles"`
+	RealDollars              bool               `json:"real_dollars"`
 }
 
 type Parameters struct {
@@ -35,24 +60,52 @@ type Parameters struct {
 	HomeValue              float64 `json:"home_value"`
 	SellHouseIn            int     `json:"sell_house_in"`
 	NewHomeRelVal          float64 `json:"new_home_relative_value"`
+	LegacyTarget           float64 `json:"legacy_target"`
+}
+
+// Horizon determines how long the simulation runs for. Ages, retirement ages,
+// the house sale etc. are all relative to the start date.
+type Horizon struct {
+	Type  string `json:"type"`  // "years", "age" or "last_survivor" (default)
+	Value int    `json:"value"` // number of years, or age of the primary person
 }
 
 type Distribution struct {
 	Mean   float64 `json:"mean"`
 	StdDev float64 `json:"std_dev"`
+
+	// Shape of the random shocks - "normal" (default), "student_t" or
+	// "skew_normal". See shocks.go.
+	Shock            string  `json:"shock"`
+	DegreesOfFreedom float64 `json:"degrees_of_freedom"` // student_t - greater than 2, default 5
+	Skew             float64 `json:"skew"`               // skew_normal - shape, negative for a longer left tail
 }
 
 type simulationTimeStep struct {
-	assets        float64
-	income        float64
-	expenses      float64
-	dateInt       int
-	maleAge       int
-	femaleAge     int
-	maleAlive     bool
-	femaleAlive   bool
-	maleRetired   bool
-	femaleRetired bool
+	assets          float64
+	accountBalances []float64 // by account, only if accounts were provided
+	// Gross amount withdrawn from each account, only if accounts were provided
+	accountWithdrawals []float64
+	inflows            float64    // cash added to (or taken from) assets, e.g. selling the house, or rent
+	income             float64    // after tax
+	taxableIncome      float64    // before tax
+	streamIncome       [2]float64 // income streams (before tax), by person
+	taxes              float64    // on income and tax-deferred withdrawals
+	fees               float64    // investment fees paid since the start
+	debtPayments       float64
+	debts              float64   // balance owing at the end of the month
+	propertyValues     []float64 // by property, only if properties were provided
+	propertyEquity     []float64 // value less debts secured against it, by property
+	expenses           float64
+	inflationFactor    float64 // cumulative inflation since the start, 1.0 = today's dollars
+	dateInt            int
+	maleAge            int
+	femaleAge          int
+	maleAlive          bool
+	femaleAlive        bool
+	maleRetired        bool
+	femaleRetired      bool
+	regime             int // regime_switching - the market regime the month was in
 }
 
 // runIndividualSimulation is a single loop through the simulation. It is called
@@ -60,8 +113,10 @@ type simulationTimeStep struct {
 // Receiver: SimulationData
 // Params: timeSteps []*timeStep -- prebuilt date steps with expenses applied
 // Params: numberOfMonthsToSimulate -- int
+// Params: trial -- int, index of the trial (its start month when backtesting)
+// Params: rng -- *rand.Rand, the random stream for this trial
 // Returns: []simulationTimeStep
-func (s *SimulationData) runIndividualSimulation(timeSteps []*timeStep, numberOfMonthsToSimulate int) []simulationTimeStep {
+func (s *SimulationData) runIndividualSimulation(timeSteps []*timeStep, numberOfMonthsToSimulate, trial int, rng *rand.Rand) []simulationTimeStep {
 
 	// Copy in data from timeSteps (includes date and expenses)
 	trialResult := make([]simulationTimeStep, len(timeSteps))
@@ -82,7 +137,10 @@ func (s *SimulationData) runIndividualSimulation(timeSteps []*timeStep, numberOf
 
 	oneHasAlreadyDied := false // Outside of loop -- using as flag
 
-	assetPerformance := s.generateAssetPerformance(numberOfMonthsToSimulate)
+	assetPerformance := s.marketPath(trial, numberOfMonthsToSimulate, rng)
+	for i, regime := range assetPerformance.Regimes {
+		trialResult[i].regime = regime
+	}
 
 	var maleAlive bool
 	var femaleAlive bool
@@ -109,14 +167,15 @@ func (s *SimulationData) runIndividualSimulation(timeSteps []*timeStep, numberOf
 
 		// Mortality results: check alive, retirement & dead
 		if monthIndex != 0 && monthIndex%12 == 0 {
-			// Mortality is tied to age, which only changes every 12 months
+			// Mortality is tied to age, which only changes every 12 months.
+			// Backtests are deterministic - everyone lives to the horizon.
 			if maleAlive {
 				maleAge++
-				maleAlive = !maleDiesAt(maleAge)
+				maleAlive = s.backtesting() || !maleDiesAt(rng, maleAge)
 			}
 			if femaleAlive {
 				femaleAge++
-				femaleAlive = !femaleDiesAt(femaleAge)
+				femaleAlive = s.backtesting() || !femaleDiesAt(rng, femaleAge)
 			}
 		}
 
@@ -169,7 +228,9 @@ func (s *SimulationData) runIndividualSimulation(timeSteps []*timeStep, numberOf
 		if someoneHasDied {
 			if !oneHasAlreadyDied {
 				oneHasAlreadyDied = true
-				trialResult[monthIndex].income += s.Parameters.LifeInsurance
+				// Paid out as a tax-free lump sum. (Adding it to income lost it
+				// when income was carried forward below.)
+				trialResult[monthIndex].inflows += s.Parameters.LifeInsurance
 			}
 
 			if s.Parameters.ExpensesMultiplier != 0.0 {
@@ -234,11 +295,12 @@ func (s *SimulationData) runIndividualSimulation(timeSteps []*timeStep, numberOf
 
 	// Inflation data comes in as monthly values. Convert to a cumulative basis
 	// so it can be cleanly mapped to an array of income/expense values.
-	monthlyInflationFactors := make([]float64, len(assetPerformance.inflationPerformance))
+	monthlyInflationFactors := make([]float64, len(assetPerformance.Inflation))
 	currentCumulativeValue := 1.0
-	for monthIndex, monthlyInflation := range assetPerformance.inflationPerformance {
+	for monthIndex, monthlyInflation := range assetPerformance.Inflation {
 		appliedInflation := currentCumulativeValue * (1 + monthlyInflation)
 		monthlyInflationFactors[monthIndex] = appliedInflation
+		trialResult[monthIndex].inflationFactor = appliedInflation
 		currentCumulativeValue = appliedInflation
 	}
 
@@ -259,40 +321,45 @@ func (s *SimulationData) runIndividualSimulation(timeSteps []*timeStep, numberOf
 		trialResult[monthIndex].income = trialResult[monthIndex].income * incomeInflationFactor
 	}
 
+	// Add government pensions etc.
+	s.applyIncomeStreams(trialResult)
+
 	/* */
 
-	// Apply taxes to income. Include varying tax rates during employment, and
-	// during retirement.
+	// Apply taxes to income. Either progressive brackets, or varying flat tax
+	// rates during employment, and during retirement.
 	for monthIndex := range trialResult {
-		applyRetirementTax := false
-		if married {
-			if trialResult[monthIndex].maleRetired && trialResult[monthIndex].femaleRetired {
-				applyRetirementTax = true
-			}
-		} else {
-			if (male && trialResult[monthIndex].maleRetired) || (!male && trialResult[monthIndex].femaleRetired) {
-				applyRetirementTax = true
-			}
-		}
-
-		if applyRetirementTax {
-			trialResult[monthIndex].income = trialResult[monthIndex].income * (1 - s.Parameters.RetirementTax/100)
+		step := &trialResult[monthIndex]
+		step.taxableIncome = step.income
+		if s.Tax.enabled() {
+			step.taxes = s.Tax.monthlyTax(s, step, 0)
 		} else {
-			trialResult[monthIndex].income = trialResult[monthIndex].income * (1 - s.Parameters.CurrentTax/100)
+			step.taxes = step.income * s.flatTaxRate(step) / 100
 		}
+		step.income -= step.taxes
 	}
 
 	// If including the home value in the simulation, apply downsize income to
 	// the appropriate time step.
 	if s.Parameters.IncludeHome {
 		houseSaleMonth := s.Parameters.SellHouseIn * 12 // Sell house in provided as year
-		relevantRealEstateReturnData := assetPerformance.realEstatePerformance[0:houseSaleMonth]
+		relevantRealEstateReturnData := assetPerformance.RealEstate[0:houseSaleMonth]
 		futureValueFactor := 1.0
 		for _, v := range relevantRealEstateReturnData {
 			futureValueFactor = futureValueFactor * (1 + v)
 		}
 		futureHomeValue := s.Parameters.HomeValue * futureValueFactor
-		trialResult[houseSaleMonth].assets += futureHomeValue * (1 - s.Parameters.NewHomeRelVal/100)
+		trialResult[houseSaleMonth].inflows += futureHomeValue * (1 - s.Parameters.NewHomeRelVal/100)
+	}
+
+	// Value other properties, adding their cash flows
+	if len(s.Properties) > 0 {
+		s.applyProperties(trialResult, timeSteps, assetPerformance.RealEstate, rng)
+	}
+
+	// Pay down mortgages and other loans, possibly from the house sale
+	if len(s.Debts) > 0 {
+		s.applyDebts(trialResult, timeSteps, assetPerformance.Inflation)
 	}
 
 	// If everyone has died, reduce the income and expenses to zero.
@@ -303,18 +370,36 @@ func (s *SimulationData) runIndividualSimulation(timeSteps []*timeStep, numberOf
 		}
 	}
 
-	// Run through the timeSteps, and adjust the asset balance based on income
-	// shortfall or excess.
-	lastPeriodEndingAssets := s.Parameters.StartingAssets
-	for monthIndex := range trialResult {
-		trialResult[monthIndex].assets = lastPeriodEndingAssets
+	// Run through the timeSteps, and adjust the account balances based on
+	// income shortfall or excess.
+	s.applyCashFlows(trialResult, timeSteps, assetPerformance)
 
-		thisMonthPortfolioReturns := lastPeriodEndingAssets * assetPerformance.portfolioPerformance[monthIndex]
-		thisMonthIncomeShortfall := trialResult[monthIndex].expenses - trialResult[monthIndex].income
-		thisMonthAssetImpact := thisMonthPortfolioReturns - thisMonthIncomeShortfall
+	return trialResult
+}
 
-		lastPeriodEndingAssets += thisMonthAssetImpact
+// householdRetired Determines if the household is fully retired in a time step
+// - i.e. both retired if married, otherwise the person is retired.
+// Receiver: SimulationData
+// Params: step *simulationTimeStep
+// Returns: bool
+func (s *SimulationData) householdRetired(step *simulationTimeStep) bool {
+	if s.Parameters.Married {
+		return step.maleRetired && step.femaleRetired
+	}
+	if s.Parameters.Male {
+		return step.maleRetired
 	}
+	return step.femaleRetired
+}
 
-	return trialResult
+// flatTaxRate returns the tax rate for a time step - the retirement rate once
+// the household is fully retired, otherwise the current rate.
+// Receiver: SimulationData
+// Params: step *simulationTimeStep
+// Returns: float64 -- 0 - 100
+func (s *SimulationData) flatTaxRate(step *simulationTimeStep) float64 {
+	if s.householdRetired(step) {
+		return s.Parameters.RetirementTax
+	}
+	return s.Parameters.CurrentTax
 }
@@ -0,0 +1,138 @@
+package simulation
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSimulateIsReproducibleWithSeed(t *testing.T) {
+	// Several chunks, so the worker pool and in-order merging are exercised
+	first := validSimulationData()
+	first.Seed = 42
+	first.NumberOfTrials = 1000
+	firstResults, err := Simulate(context.Background(), first, Limits{Workers: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	second := validSimulationData()
+	second.Seed = 42
+	second.NumberOfTrials = 1000
+	secondResults, err := Simulate(context.Background(), second, Limits{Workers: 8})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(firstResults, secondResults) {
+		t.Error("Same seed should give identical results")
+	}
+}
+
+func TestSimulatePicksAndReportsSeed(t *testing.T) {
+	s := validSimulationData()
+	Simulate(context.Background(), s, DefaultLimits())
+
+	if s.Seed == 0 {
+		t.Error("Expected a seed to be picked")
+	}
+}
+
+func TestTrialSeedsDiffer(t *testing.T) {
+	if trialSeed(42, 0) == trialSeed(42, 1) || trialSeed(42, 0) == trialSeed(43, 0) {
+		t.Error("Expected independent trial seeds")
+	}
+}
+
+func TestSimulateEnforcesTrialBudget(t *testing.T) {
+	s := validSimulationData()
+	_, err := Simulate(context.Background(), s, Limits{MaxTrials: 5})
+
+	if _, ok := err.(*TrialBudgetError); !ok {
+		t.Error("Expected a TrialBudgetError, got", err)
+	}
+}
+
+func TestSimulateStopsWhenCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	s := validSimulationData()
+	s.NumberOfTrials = 1000
+	_, err := Simulate(ctx, s, Limits{Workers: 1})
+
+	if err != context.Canceled {
+		t.Error("Expected context.Canceled, got", err)
+	}
+}
+
+func TestSimulateEnforcesTimeBudget(t *testing.T) {
+	s := validSimulationData()
+	s.NumberOfTrials = 100000
+	_, err := Simulate(context.Background(), s, Limits{Workers: 1, MaxDuration: time.Millisecond})
+
+	if err != ErrTimeBudgetExceeded {
+		t.Error("Expected ErrTimeBudgetExceeded, got", err)
+	}
+}
+
+func TestSimulateResponseKeepsFlatTimestepFields(t *testing.T) {
+	s := validSimulationData()
+	s.RealDollars = true
+	results, _ := Simulate(context.Background(), s, DefaultLimits())
+
+	encoded, _ := json.Marshal(results.Timesteps[0])
+	var decoded map[string]interface{}
+	json.Unmarshal(encoded, &decoded)
+
+	if _, ok := decoded["assets_mean"]; !ok {
+		t.Error("Expected assets_mean at the top level, got", string(encoded))
+	}
+	if _, ok := decoded["real"].(map[string]interface{})["assets_mean"]; !ok {
+		t.Error("Expected real.assets_mean, got", string(encoded))
+	}
+}
+
+func TestNumberOfMonthsToSimulate(t *testing.T) {
+	s := validSimulationData() // male 29, female 30
+
+	if numberOfMonthsToSimulate(s) != (120-29)*12 {
+		t.Error("Expected to run until the youngest is 120, got", numberOfMonthsToSimulate(s))
+	}
+
+	s.Horizon = Horizon{Type: "years", Value: 30}
+	if numberOfMonthsToSimulate(s) != 360 {
+		t.Error("Expected 30 years, got", numberOfMonthsToSimulate(s))
+	}
+
+	s.Horizon = Horizon{Type: "age", Value: 95}
+	if numberOfMonthsToSimulate(s) != (95-29)*12 {
+		t.Error("Expected to run until the primary person is 95, got", numberOfMonthsToSimulate(s))
+	}
+}
+
+func TestLifeInsurancePaidOnFirstDeath(t *testing.T) {
+	s := validSimulationData()
+	s.Parameters.MaleAge = 100
+	s.Parameters.FemaleAge = 100
+	s.Parameters.IncludeHome = false
+	numberOfMonths := numberOfMonthsToSimulate(s)
+	trialResult := s.runIndividualSimulation(s.applyExpenses(numberOfMonths), numberOfMonths, 0, trialRand(1, 0))
+
+	var total float64
+	firstDeath := -1
+	for monthIndex, step := range trialResult {
+		if firstDeath < 0 && !(step.maleAlive && step.femaleAlive) {
+			firstDeath = monthIndex
+		}
+		total += step.inflows
+	}
+	if firstDeath < 0 || trialResult[firstDeath].inflows != s.Parameters.LifeInsurance {
+		t.Error("Expected the payout in the month of the first death, got", firstDeath)
+	}
+	if total != s.Parameters.LifeInsurance {
+		t.Error("Expected life insurance to be paid out once, got", total)
+	}
+}
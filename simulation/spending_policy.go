@@ -0,0 +1,182 @@
+package simulation
+
+import "math"
+
+// SpendingPolicy sets how much is drawn from the portfolio once the household
+// is fully retired, based on each trial's own running balance. With a policy
+// other than "fixed", retirement spending is the income for the month plus the
+// policy's withdrawal, in place of the expense schedule.
+type SpendingPolicy struct {
+	// "fixed" (default - the expense schedule), "guardrails",
+	// "constant_percentage", "vpw" or "floor_ceiling"
+	Type string `json:"type"`
+
+	// Percentage of the portfolio withdrawn a year. For guardrails and
+	// floor_ceiling, the rate in the first year of retirement.
+	WithdrawalRate float64 `json:"withdrawal_rate"`
+
+	// guardrails - how far (%) the withdrawal rate can drift above / below
+	// the initial rate before spending is cut / raised, and by how much (%).
+	// Default to 20, 20 and 10.
+	UpperGuardrail float64 `json:"upper_guardrail"`
+	LowerGuardrail float64 `json:"lower_guardrail"`
+	Adjustment     float64 `json:"adjustment"`
+
+	// floor_ceiling - limits (% of the first year's withdrawal, adjusted for
+	// inflation). Default to 90 and 120.
+	Floor   float64 `json:"floor"`
+	Ceiling float64 `json:"ceiling"`
+
+	// vpw - expected real annual return (%), and the age of the primary
+	// person to spend the portfolio down by (default 100).
+	ExpectedReturn float64 `json:"expected_return"`
+	EndAge         int     `json:"end_age"`
+}
+
+// spendingPolicyTypes are the policies that can be chosen by name
+var spendingPolicyTypes = []string{"fixed", "guardrails", "constant_percentage", "vpw", "floor_ceiling"}
+
+// isFixed Determines if spending just follows the expense schedule
+// Receiver: SpendingPolicy
+// Params: None
+// Returns: bool
+func (p *SpendingPolicy) isFixed() bool {
+	return p.Type == "" || p.Type == "fixed"
+}
+
+// orDefault returns value, or fallback if value is zero
+// Params: value, fallback float64
+// Returns: float64
+func orDefault(value, fallback float64) float64 {
+	if value == 0 {
+		return fallback
+	}
+	return value
+}
+
+// spendingState tracks a spending policy through a single trial. Withdrawals
+// are reset once a year, starting from the first month of retirement.
+type spendingState struct {
+	policy   *SpendingPolicy
+	startAge int // primary person's age at the start of the simulation
+	started  bool
+	months   int // months since the withdrawal was last reset
+
+	annualWithdrawal float64
+	initialRate      float64 // guardrails - rate in the first year
+	initialReal      float64 // floor_ceiling - first year's withdrawal in today's dollars
+	lastInflation    float64 // inflation factor at the last reset
+	gains            float64 // investment gains since the last reset
+}
+
+// newSpendingState returns the state for a trial, or nil if spending follows
+// the expense schedule.
+// Receiver: SimulationData
+// Params: None
+// Returns: *spendingState
+func (s *SimulationData) newSpendingState() *spendingState {
+	if s.SpendingPolicy.isFixed() {
+		return nil
+	}
+	return &spendingState{policy: &s.SpendingPolicy, startAge: s.primaryAge()}
+}
+
+// recordGains adds to the investment gains since the last reset
+// Receiver: *spendingState
+// Params: gains float64
+// Returns: None
+func (sp *spendingState) recordGains(gains float64) {
+	sp.gains += gains
+}
+
+// monthlyWithdrawal returns the after-tax amount to draw from the portfolio
+// this month, resetting the annual withdrawal if a year has passed.
+// Receiver: *spendingState
+// Params: step *simulationTimeStep
+// Params: monthIndex int
+// Params: assets float64 -- portfolio balance at the start of the month
+// Returns: float64
+func (sp *spendingState) monthlyWithdrawal(step *simulationTimeStep, monthIndex int, assets float64) float64 {
+	if !sp.started || sp.months == 12 {
+		sp.reset(step, monthIndex, assets)
+	}
+	sp.months++
+	return sp.annualWithdrawal / 12
+}
+
+// reset works out the withdrawal for the coming year
+// Receiver: *spendingState
+// Params: step *simulationTimeStep
+// Params: monthIndex int
+// Params: assets float64 -- portfolio balance at the start of the month
+// Returns: None
+func (sp *spendingState) reset(step *simulationTimeStep, monthIndex int, assets float64) {
+	p := sp.policy
+	rate := p.WithdrawalRate / 100
+	balance := math.Max(assets, 0)
+	first := !sp.started
+
+	switch p.Type {
+	case "constant_percentage":
+		sp.annualWithdrawal = rate * balance
+
+	case "vpw":
+		endAge := p.EndAge
+		if endAge == 0 {
+			endAge = 100
+		}
+		yearsLeft := endAge - (sp.startAge + monthIndex/12)
+		sp.annualWithdrawal = vpwRate(p.ExpectedReturn/100, yearsLeft) * balance
+
+	case "guardrails":
+		if first {
+			sp.initialRate = rate
+			sp.annualWithdrawal = rate * balance
+			break
+		}
+		// Inflation rule - no raise after a losing year if already
+		// withdrawing more than the initial rate.
+		currentRate := sp.annualWithdrawal / balance
+		if !(sp.gains < 0 && currentRate > sp.initialRate) {
+			sp.annualWithdrawal *= step.inflationFactor / sp.lastInflation
+		}
+		currentRate = sp.annualWithdrawal / balance
+		if currentRate > sp.initialRate*(1+orDefault(p.UpperGuardrail, 20)/100) {
+			sp.annualWithdrawal *= 1 - orDefault(p.Adjustment, 10)/100
+		} else if currentRate < sp.initialRate*(1-orDefault(p.LowerGuardrail, 20)/100) {
+			sp.annualWithdrawal *= 1 + orDefault(p.Adjustment, 10)/100
+		}
+
+	case "floor_ceiling":
+		sp.annualWithdrawal = rate * balance
+		if first {
+			sp.initialReal = sp.annualWithdrawal / step.inflationFactor
+		}
+		initial := sp.initialReal * step.inflationFactor
+		floor := initial * orDefault(p.Floor, 90) / 100
+		ceiling := initial * orDefault(p.Ceiling, 120) / 100
+		sp.annualWithdrawal = math.Min(math.Max(sp.annualWithdrawal, floor), ceiling)
+	}
+
+	sp.started = true
+	sp.months = 0
+	sp.gains = 0
+	sp.lastInflation = step.inflationFactor
+}
+
+// vpwRate returns the variable percentage withdrawal rate - the fraction of the
+// portfolio that, withdrawn as a level annual payment, would spend it down over
+// the years left at the expected return.
+// Params: expectedReturn float64 -- real annual return, e.g. 0.04
+// Params: yearsLeft int
+// Returns: float64
+func vpwRate(expectedReturn float64, yearsLeft int) float64 {
+	if yearsLeft < 1 {
+		yearsLeft = 1
+	}
+	if expectedReturn == 0 {
+		return 1 / float64(yearsLeft)
+	}
+	// Payments at the start of each year
+	return expectedReturn / (1 + expectedReturn) / (1 - math.Pow(1+expectedReturn, -float64(yearsLeft)))
+}
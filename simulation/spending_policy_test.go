@@ -0,0 +1,98 @@
+package simulation
+
+import (
+	"context"
+	"math"
+	"testing"
+)
+
+func TestConstantPercentageResetsYearly(t *testing.T) {
+	sp := &spendingState{policy: &SpendingPolicy{Type: "constant_percentage", WithdrawalRate: 4}}
+	step := &simulationTimeStep{inflationFactor: 1}
+
+	for month := 0; month < 12; month++ {
+		// The balance during the year doesn't matter, only at the reset
+		if withdrawal := sp.monthlyWithdrawal(step, month, 120000-float64(month)*1000); withdrawal != 400 {
+			t.Error("Expected 400 a month, got", withdrawal, "in month", month)
+		}
+	}
+	if withdrawal := sp.monthlyWithdrawal(step, 12, 60000); withdrawal != 200 {
+		t.Error("Expected 200 a month after the reset, got", withdrawal)
+	}
+}
+
+func TestGuardrails(t *testing.T) {
+	sp := &spendingState{policy: &SpendingPolicy{Type: "guardrails", WithdrawalRate: 5}}
+
+	sp.reset(&simulationTimeStep{inflationFactor: 1}, 0, 100000)
+	if sp.annualWithdrawal != 5000 {
+		t.Error("Expected an initial withdrawal of 5000, got", sp.annualWithdrawal)
+	}
+
+	// Portfolio fell - rate is now 5000 / 70000 = 7.1%, above the 6% upper
+	// guardrail, and no inflation raise after a losing year.
+	sp.recordGains(-30000)
+	sp.reset(&simulationTimeStep{inflationFactor: 1.03}, 12, 70000)
+	if !closeTo(sp.annualWithdrawal, 4500, 1e-9) {
+		t.Error("Expected a 10% cut to 4500, got", sp.annualWithdrawal)
+	}
+
+	// Portfolio grew - inflation raise, then below the 4% lower guardrail
+	sp.recordGains(80000)
+	sp.reset(&simulationTimeStep{inflationFactor: 1.03 * 1.02}, 24, 150000)
+	if !closeTo(sp.annualWithdrawal, 4500*1.02*1.1, 1e-9) {
+		t.Error("Expected an inflation raise and a 10% increase, got", sp.annualWithdrawal)
+	}
+}
+
+func TestFloorCeiling(t *testing.T) {
+	sp := &spendingState{policy: &SpendingPolicy{Type: "floor_ceiling", WithdrawalRate: 4}}
+
+	sp.reset(&simulationTimeStep{inflationFactor: 1}, 0, 100000)
+	sp.reset(&simulationTimeStep{inflationFactor: 1.1}, 12, 50000)
+	if !closeTo(sp.annualWithdrawal, 4000*1.1*0.9, 1e-9) {
+		t.Error("Expected withdrawal held at the floor, got", sp.annualWithdrawal)
+	}
+	sp.reset(&simulationTimeStep{inflationFactor: 1.1}, 24, 500000)
+	if !closeTo(sp.annualWithdrawal, 4000*1.1*1.2, 1e-9) {
+		t.Error("Expected withdrawal held at the ceiling, got", sp.annualWithdrawal)
+	}
+}
+
+func TestVpwRate(t *testing.T) {
+	if vpwRate(0, 25) != 0.04 {
+		t.Error("Expected 1/25 with no return, got", vpwRate(0, 25))
+	}
+	if !closeTo(vpwRate(0.05, 1), 1, 1e-12) || !closeTo(vpwRate(0.05, -3), 1, 1e-12) {
+		t.Error("Expected everything to be withdrawn in the last year")
+	}
+	// Level payments at the start of each year spend the portfolio down exactly
+	balance := 1000.0
+	payment := vpwRate(0.05, 3) * balance
+	for year := 0; year < 3; year++ {
+		balance = (balance - payment) * 1.05
+	}
+	if math.Abs(balance) > 1e-9 {
+		t.Error("Expected the portfolio to be spent down, got", balance)
+	}
+}
+
+func TestSimulateWithSpendingPolicyNeverRunsOut(t *testing.T) {
+	s := validSimulationData()
+	s.Parameters.MaleAge, s.Parameters.FemaleAge = 70, 70
+	s.Parameters.RetirementAgeMale, s.Parameters.RetirementAgeFemale = 65, 65
+	s.Parameters.IncludeHome = false
+	s.SpendingPolicy = SpendingPolicy{Type: "constant_percentage", WithdrawalRate: 4}
+
+	results, err := Simulate(context.Background(), s, DefaultLimits())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results.Summary.ProbabilityOfSuccess != 1 {
+		t.Error("Expected a percentage of the portfolio never to run out, got", results.Summary.ProbabilityOfSuccess)
+	}
+	first := results.Timesteps[0]
+	if !closeTo(first.ExpensesMean-first.IncomeMean, 125000*0.04/12, 1e-9) {
+		t.Error("Expected spending of income plus 4% of the portfolio, got", first.ExpensesMean, first.IncomeMean)
+	}
+}
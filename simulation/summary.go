@@ -0,0 +1,516 @@
+package simulation
+
+import (
+	"math"
+	"strconv"
+)
+
+type summarizedTimeStep struct {
+	cashFlowSummary
+
+	// The same figures deflated to today's dollars using each trial's own
+	// inflation path. Only present if real dollars were requested.
+	Real *cashFlowSummary `json:"real,omitempty"`
+
+	// Balance of each account at the start of the period, and the amount
+	// withdrawn from it during the period, keyed by account id. Only present
+	// if accounts were provided.
+	Accounts map[string]accountSummary `json:"accounts,omitempty"`
+
+	// Investment fees paid since the start. Only present if there are fees.
+	Fees *seriesSummary `json:"fees,omitempty"`
+
+	// Balance owing on debts at the end of the period. Only present if there
+	// are debts.
+	Debts *seriesSummary `json:"debts,omitempty"`
+
+	// Value and equity (value less debts secured against it) of each
+	// property, keyed by property id. Only present if properties were
+	// provided.
+	Properties map[string]propertySummary `json:"properties,omitempty"`
+
+	// Assets plus property values, less debts. Only present if there are
+	// debts or properties.
+	NetWorth *seriesSummary `json:"net_worth,omitempty"`
+
+	OutOfMoneyPercentage float64 `json:"out_of_money_percentage"`
+	DateInt              int     `json:"date"`
+}
+
+type propertySummary struct {
+	Value  seriesSummary `json:"value"`
+	Equity seriesSummary `json:"equity"`
+}
+
+type accountSummary struct {
+	Balance     seriesSummary `json:"balance"`
+	Withdrawals seriesSummary `json:"withdrawals"`
+}
+
+// seriesSummary is the mean, confidence interval and (if requested) percentile
+// bands of a single series
+type seriesSummary struct {
+	Mean        float64            `json:"mean"`
+	CILow       float64            `json:"ci_low"`
+	CIHigh      float64            `json:"ci_high"`
+	Percentiles map[string]float64 `json:"percentiles,omitempty"`
+}
+
+type cashFlowSummary struct {
+	AssetsMean   float64 `json:"assets_mean"`
+	AssetsCILow  float64 `json:"assets_ci_low"`
+	AssetsCIHigh float64 `json:"assets_ci_high"`
+
+	IncomeMean   float64 `json:"income_mean"`
+	IncomeCILow  float64 `json:"income_ci_low"`
+	IncomeCIHigh float64 `json:"income_ci_high"`
+
+	ExpensesMean   float64 `json:"expenses_mean"`
+	ExpensesCILow  float64 `json:"expenses_ci_low"`
+	ExpensesCIHigh float64 `json:"expenses_ci_high"`
+
+	// Tax paid on income and tax-deferred withdrawals
+	TaxesMean   float64 `json:"taxes_mean"`
+	TaxesCILow  float64 `json:"taxes_ci_low"`
+	TaxesCIHigh float64 `json:"taxes_ci_high"`
+
+	// Percentile bands, keyed by percentile (e.g. "5", "50", "97.5"). Only
+	// present if percentiles were requested.
+	AssetsPercentiles   map[string]float64 `json:"assets_percentiles,omitempty"`
+	IncomePercentiles   map[string]float64 `json:"income_percentiles,omitempty"`
+	ExpensesPercentiles map[string]float64 `json:"expenses_percentiles,omitempty"`
+	TaxesPercentiles    map[string]float64 `json:"taxes_percentiles,omitempty"`
+}
+
+// statAccumulator keeps running statistics for a stream of values - mean and
+// variance (Welford's algorithm) plus a quantile sketch - without holding on
+// to the values themselves.
+type statAccumulator struct {
+	count  int
+	mean   float64
+	m2     float64 // sum of squared differences from the mean
+	sketch *quantileSketch
+}
+
+// newStatAccumulator returns an empty accumulator
+// Receiver: None
+// Params: None
+// Returns: statAccumulator
+func newStatAccumulator() statAccumulator {
+	return statAccumulator{sketch: newQuantileSketch()}
+}
+
+// add records a single value
+// Receiver: *statAccumulator
+// Params: x float64
+// Returns: None
+func (a *statAccumulator) add(x float64) {
+	a.count++
+	delta := x - a.mean
+	a.mean += delta / float64(a.count)
+	a.m2 += delta * (x - a.mean)
+	a.sketch.add(x)
+}
+
+// merge folds another accumulator into this one (Chan et al.'s parallel
+// variance algorithm).
+// Receiver: *statAccumulator
+// Params: other *statAccumulator
+// Returns: None
+func (a *statAccumulator) merge(other *statAccumulator) {
+	if other.count == 0 {
+		return
+	}
+	total := float64(a.count + other.count)
+	delta := other.mean - a.mean
+	a.mean += delta * float64(other.count) / total
+	a.m2 += other.m2 + delta*delta*float64(a.count)*float64(other.count)/total
+	a.count += other.count
+	a.sketch.merge(other.sketch)
+}
+
+// sampleStdDev returns the sample standard deviation, or zero if there are not
+// enough values to compute one.
+// Receiver: *statAccumulator
+// Params: None
+// Returns: float64
+func (a *statAccumulator) sampleStdDev() float64 {
+	if a.count < 2 {
+		return 0
+	}
+	return math.Sqrt(a.m2 / float64(a.count-1))
+}
+
+// ciFactor returns the half-width of the 95% confidence interval on the mean
+// Receiver: *statAccumulator
+// Params: None
+// Returns: float64
+func (a *statAccumulator) ciFactor() float64 {
+	if a.count == 0 {
+		return 0
+	}
+	return 1.96 * a.sampleStdDev() / math.Sqrt(float64(a.count))
+}
+
+// percentiles estimates the requested percentiles from the quantile sketch
+// Receiver: *statAccumulator
+// Params: percentiles []float64 -- each 0 - 100
+// Returns: map[string]float64 -- keyed by percentileKey, nil if none requested
+func (a *statAccumulator) percentiles(percentiles []float64) map[string]float64 {
+	if len(percentiles) == 0 {
+		return nil
+	}
+	results := make(map[string]float64, len(percentiles))
+	for _, p := range percentiles {
+		results[percentileKey(p)] = a.sketch.quantile(p / 100)
+	}
+	return results
+}
+
+// summarize generates the mean, confidence interval and percentile bands
+// Receiver: *statAccumulator
+// Params: percentiles []float64 -- percentile bands to report, may be empty
+// Returns: seriesSummary
+func (a *statAccumulator) summarize(percentiles []float64) seriesSummary {
+	ciFactor := a.ciFactor()
+	return seriesSummary{
+		Mean:        a.mean,
+		CILow:       a.mean - ciFactor,
+		CIHigh:      a.mean + ciFactor,
+		Percentiles: a.percentiles(percentiles),
+	}
+}
+
+// percentileKey formats a percentile for use as a JSON key, e.g. 5 -> "5",
+// 97.5 -> "97.5"
+// Params: p float64
+// Returns: string
+func percentileKey(p float64) string {
+	return strconv.FormatFloat(p, 'f', -1, 64)
+}
+
+// cashFlowAccumulator holds the running statistics for assets, income,
+// expenses and taxes
+type cashFlowAccumulator struct {
+	assets   statAccumulator
+	income   statAccumulator
+	expenses statAccumulator
+	taxes    statAccumulator
+}
+
+// newCashFlowAccumulator returns an empty accumulator
+// Receiver: None
+// Params: None
+// Returns: *cashFlowAccumulator
+func newCashFlowAccumulator() *cashFlowAccumulator {
+	return &cashFlowAccumulator{
+		assets:   newStatAccumulator(),
+		income:   newStatAccumulator(),
+		expenses: newStatAccumulator(),
+		taxes:    newStatAccumulator(),
+	}
+}
+
+// add records a single trial's values for the period
+// Receiver: *cashFlowAccumulator
+// Params: assets, income, expenses, taxes float64
+// Returns: None
+func (c *cashFlowAccumulator) add(assets, income, expenses, taxes float64) {
+	c.assets.add(assets)
+	c.income.add(income)
+	c.expenses.add(expenses)
+	c.taxes.add(taxes)
+}
+
+// merge folds another accumulator into this one
+// Receiver: *cashFlowAccumulator
+// Params: other *cashFlowAccumulator
+// Returns: None
+func (c *cashFlowAccumulator) merge(other *cashFlowAccumulator) {
+	c.assets.merge(&other.assets)
+	c.income.merge(&other.income)
+	c.expenses.merge(&other.expenses)
+	c.taxes.merge(&other.taxes)
+}
+
+// summarize generates the mean, confidence interval and percentile bands
+// Receiver: *cashFlowAccumulator
+// Params: percentiles []float64 -- percentile bands to report, may be empty
+// Returns: cashFlowSummary
+func (c *cashFlowAccumulator) summarize(percentiles []float64) cashFlowSummary {
+	assetsCIFactor := c.assets.ciFactor()
+	incomeCIFactor := c.income.ciFactor()
+	expensesCIFactor := c.expenses.ciFactor()
+	taxesCIFactor := c.taxes.ciFactor()
+
+	return cashFlowSummary{
+		AssetsMean:   c.assets.mean,
+		AssetsCILow:  c.assets.mean - assetsCIFactor,
+		AssetsCIHigh: c.assets.mean + assetsCIFactor,
+
+		IncomeMean:   c.income.mean,
+		IncomeCILow:  c.income.mean - incomeCIFactor,
+		IncomeCIHigh: c.income.mean + incomeCIFactor,
+
+		ExpensesMean:   c.expenses.mean,
+		ExpensesCILow:  c.expenses.mean - expensesCIFactor,
+		ExpensesCIHigh: c.expenses.mean + expensesCIFactor,
+
+		TaxesMean:   c.taxes.mean,
+		TaxesCILow:  c.taxes.mean - taxesCIFactor,
+		TaxesCIHigh: c.taxes.mean + taxesCIFactor,
+
+		AssetsPercentiles:   c.assets.percentiles(percentiles),
+		IncomePercentiles:   c.income.percentiles(percentiles),
+		ExpensesPercentiles: c.expenses.percentiles(percentiles),
+		TaxesPercentiles:    c.taxes.percentiles(percentiles),
+	}
+}
+
+// accountAccumulator holds the running statistics for a single account
+type accountAccumulator struct {
+	balance     statAccumulator
+	withdrawals statAccumulator
+}
+
+// propertyAccumulator holds the running statistics for a single property
+type propertyAccumulator struct {
+	value  statAccumulator
+	equity statAccumulator
+}
+
+// periodAccumulator holds the running statistics for a single time step,
+// across all of the trials folded into it so far.
+type periodAccumulator struct {
+	nominal    *cashFlowAccumulator
+	real       *cashFlowAccumulator // nil unless real dollars were requested
+	accounts   []accountAccumulator
+	fees       *statAccumulator // nil unless there are fees
+	debts      *statAccumulator // nil unless there are debts
+	properties []propertyAccumulator
+	netWorth   *statAccumulator // nil unless there are debts or properties
+	outOfMoney int
+	dateInt    int
+}
+
+// summaryAccumulator summarizes trials as they finish, so only one set of
+// per-period statistics is kept in memory rather than every trial. Trials and
+// other accumulators can be added in any grouping, but must be added in the
+// same order to get byte-identical results.
+type summaryAccumulator struct {
+	numberOfTrials int
+	periods        []periodAccumulator
+	accountIds     []string
+	propertyIds    []string
+	plan           planAccumulator
+}
+
+// newSummaryAccumulator returns an empty accumulator for a given number of
+// periods. Which optional series are tracked is taken from the simulation
+// data.
+// Receiver: None
+// Params: s *SimulationData
+// Params: numberOfPeriods int
+// Returns: *summaryAccumulator
+func newSummaryAccumulator(s *SimulationData, numberOfPeriods int) *summaryAccumulator {
+	periods := make([]periodAccumulator, numberOfPeriods)
+	for i := range periods {
+		periods[i].nominal = newCashFlowAccumulator()
+		if s.RealDollars {
+			periods[i].real = newCashFlowAccumulator()
+		}
+		periods[i].accounts = make([]accountAccumulator, len(s.Accounts))
+		for account := range periods[i].accounts {
+			periods[i].accounts[account] = accountAccumulator{
+				balance:     newStatAccumulator(),
+				withdrawals: newStatAccumulator(),
+			}
+		}
+		if s.Fees.enabled() {
+			fees := newStatAccumulator()
+			periods[i].fees = &fees
+		}
+		if len(s.Debts) > 0 {
+			debts := newStatAccumulator()
+			periods[i].debts = &debts
+		}
+		periods[i].properties = make([]propertyAccumulator, len(s.Properties))
+		for property := range periods[i].properties {
+			periods[i].properties[property] = propertyAccumulator{
+				value:  newStatAccumulator(),
+				equity: newStatAccumulator(),
+			}
+		}
+		if len(s.Debts) > 0 || len(s.Properties) > 0 {
+			netWorth := newStatAccumulator()
+			periods[i].netWorth = &netWorth
+		}
+	}
+	accountIds := make([]string, len(s.Accounts))
+	for i, account := range s.Accounts {
+		accountIds[i] = account.Id
+	}
+	propertyIds := make([]string, len(s.Properties))
+	for i, property := range s.Properties {
+		propertyIds[i] = property.Id
+	}
+	return &summaryAccumulator{
+		periods:     periods,
+		accountIds:  accountIds,
+		propertyIds: propertyIds,
+		plan:        newPlanAccumulator(s.Parameters.LegacyTarget, s.Fees.enabled()),
+	}
+}
+
+// addTrial folds a single finished trial into the accumulator
+// Receiver: *summaryAccumulator
+// Params: trial []simulationTimeStep
+// Returns: None
+func (a *summaryAccumulator) addTrial(trial []simulationTimeStep) {
+	a.numberOfTrials++
+	for period, step := range trial {
+		p := &a.periods[period]
+		p.dateInt = step.dateInt // same in every trial
+		p.nominal.add(step.assets, step.income, step.expenses, step.taxes)
+		if p.real != nil {
+			factor := step.inflationFactor
+			p.real.add(step.assets/factor, step.income/factor, step.expenses/factor, step.taxes/factor)
+		}
+		for account, balance := range step.accountBalances {
+			p.accounts[account].balance.add(balance)
+			p.accounts[account].withdrawals.add(step.accountWithdrawals[account])
+		}
+		if p.fees != nil {
+			p.fees.add(step.fees)
+		}
+		if p.debts != nil {
+			p.debts.add(step.debts)
+		}
+		netWorth := step.assets - step.debts
+		for property, value := range step.propertyValues {
+			p.properties[property].value.add(value)
+			p.properties[property].equity.add(step.propertyEquity[property])
+			netWorth += value
+		}
+		if p.netWorth != nil {
+			p.netWorth.add(netWorth)
+		}
+		if step.assets < 0 {
+			p.outOfMoney++
+		}
+	}
+}
+
+// addOutcome folds a single trial's plan-level outcome into the accumulator
+// Receiver: *summaryAccumulator
+// Params: outcome trialOutcome
+// Returns: None
+func (a *summaryAccumulator) addOutcome(outcome trialOutcome) {
+	a.plan.addOutcome(outcome)
+}
+
+// merge folds another accumulator (e.g. from another worker) into this one
+// Receiver: *summaryAccumulator
+// Params: other *summaryAccumulator
+// Returns: None
+func (a *summaryAccumulator) merge(other *summaryAccumulator) {
+	a.numberOfTrials += other.numberOfTrials
+	for period := range a.periods {
+		p, o := &a.periods[period], &other.periods[period]
+		if o.dateInt != 0 {
+			p.dateInt = o.dateInt
+		}
+		p.nominal.merge(o.nominal)
+		if p.real != nil {
+			p.real.merge(o.real)
+		}
+		for account := range p.accounts {
+			p.accounts[account].balance.merge(&o.accounts[account].balance)
+			p.accounts[account].withdrawals.merge(&o.accounts[account].withdrawals)
+		}
+		if p.fees != nil {
+			p.fees.merge(o.fees)
+		}
+		if p.debts != nil {
+			p.debts.merge(o.debts)
+		}
+		for property := range p.properties {
+			p.properties[property].value.merge(&o.properties[property].value)
+			p.properties[property].equity.merge(&o.properties[property].equity)
+		}
+		if p.netWorth != nil {
+			p.netWorth.merge(o.netWorth)
+		}
+		p.outOfMoney += o.outOfMoney
+	}
+	a.plan.merge(&other.plan)
+}
+
+// dates returns the date of each period
+// Receiver: *summaryAccumulator
+// Params: None
+// Returns: []int
+func (a *summaryAccumulator) dates() []int {
+	dates := make([]int, len(a.periods))
+	for period := range a.periods {
+		dates[period] = a.periods[period].dateInt
+	}
+	return dates
+}
+
+// summarize generates the descriptive statistics for each period, so we don't
+// have to send tens of thousands of trials down to the client.
+// Receiver: *summaryAccumulator
+// Params: percentiles []float64 -- percentile bands to report, may be empty
+// Returns: []summarizedTimeStep
+func (a *summaryAccumulator) summarize(percentiles []float64) []summarizedTimeStep {
+	summarizedResults := make([]summarizedTimeStep, len(a.periods))
+
+	for period := range a.periods {
+		p := &a.periods[period]
+
+		summarizedResults[period] = summarizedTimeStep{
+			cashFlowSummary:      p.nominal.summarize(percentiles),
+			OutOfMoneyPercentage: float64(p.outOfMoney) / float64(a.numberOfTrials),
+			DateInt:              p.dateInt,
+		}
+		if p.real != nil {
+			realSummary := p.real.summarize(percentiles)
+			summarizedResults[period].Real = &realSummary
+		}
+		if len(a.accountIds) > 0 {
+			accounts := make(map[string]accountSummary, len(a.accountIds))
+			for account, id := range a.accountIds {
+				accounts[id] = accountSummary{
+					Balance:     p.accounts[account].balance.summarize(percentiles),
+					Withdrawals: p.accounts[account].withdrawals.summarize(percentiles),
+				}
+			}
+			summarizedResults[period].Accounts = accounts
+		}
+		if p.fees != nil {
+			fees := p.fees.summarize(percentiles)
+			summarizedResults[period].Fees = &fees
+		}
+		if p.debts != nil {
+			debts := p.debts.summarize(percentiles)
+			summarizedResults[period].Debts = &debts
+		}
+		if len(a.propertyIds) > 0 {
+			properties := make(map[string]propertySummary, len(a.propertyIds))
+			for property, id := range a.propertyIds {
+				properties[id] = propertySummary{
+					Value:  p.properties[property].value.summarize(percentiles),
+					Equity: p.properties[property].equity.summarize(percentiles),
+				}
+			}
+			summarizedResults[period].Properties = properties
+		}
+		if p.netWorth != nil {
+			netWorth := p.netWorth.summarize(percentiles)
+			summarizedResults[period].NetWorth = &netWorth
+		}
+	}
+
+	return summarizedResults
+}
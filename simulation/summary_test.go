@@ -0,0 +1,171 @@
+package simulation
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+
+	goStats "github.com/GaryBoone/GoStats/stats"
+)
+
+func randomTrials(numberOfTrials, numberOfPeriods int) [][]simulationTimeStep {
+	rng := rand.New(rand.NewSource(42))
+	trials := make([][]simulationTimeStep, numberOfTrials)
+	for i := range trials {
+		trials[i] = make([]simulationTimeStep, numberOfPeriods)
+		for period := range trials[i] {
+			trials[i][period] = simulationTimeStep{
+				assets:   rng.NormFloat64()*50000 + 10000,
+				income:   rng.Float64() * 5000,
+				expenses: rng.ExpFloat64() * 3000,
+				dateInt:  1000 + period,
+
+				inflationFactor: 1 + float64(period)/100,
+			}
+		}
+	}
+	return trials
+}
+
+func closeTo(a, b, tolerance float64) bool {
+	return math.Abs(a-b) <= tolerance*math.Max(1, math.Abs(b))
+}
+
+func TestSummaryAccumulatorMatchesDirectStatistics(t *testing.T) {
+	trials := randomTrials(200, 12)
+
+	accumulator := newSummaryAccumulator(&SimulationData{}, 12)
+	for _, trial := range trials {
+		accumulator.addTrial(trial)
+	}
+	summarized := accumulator.summarize(nil)
+
+	for period := 0; period < 12; period++ {
+		assets := make([]float64, len(trials))
+		outOfMoney := 0.0
+		for i, trial := range trials {
+			assets[i] = trial[period].assets
+			if trial[period].assets < 0 {
+				outOfMoney++
+			}
+		}
+		mean := goStats.StatsMean(assets)
+		ciFactor := 1.96 * goStats.StatsSampleStandardDeviation(assets) / math.Sqrt(float64(len(trials)))
+
+		if !closeTo(summarized[period].AssetsMean, mean, 1e-9) {
+			t.Error("Mean mismatch for period", period, "expected", mean, "got", summarized[period].AssetsMean)
+		}
+		if !closeTo(summarized[period].AssetsCIHigh, mean+ciFactor, 1e-9) {
+			t.Error("CI mismatch for period", period, "expected", mean+ciFactor, "got", summarized[period].AssetsCIHigh)
+		}
+		if summarized[period].OutOfMoneyPercentage != outOfMoney/float64(len(trials)) {
+			t.Error("Out of money mismatch for period", period)
+		}
+		if summarized[period].DateInt != 1000+period {
+			t.Error("Date mismatch for period", period)
+		}
+	}
+}
+
+func TestSummaryAccumulatorMerge(t *testing.T) {
+	trials := randomTrials(100, 3)
+
+	whole := newSummaryAccumulator(&SimulationData{}, 3)
+	first := newSummaryAccumulator(&SimulationData{}, 3)
+	second := newSummaryAccumulator(&SimulationData{}, 3)
+	for i, trial := range trials {
+		whole.addTrial(trial)
+		if i < 30 {
+			first.addTrial(trial)
+		} else {
+			second.addTrial(trial)
+		}
+	}
+	first.merge(second)
+
+	expected, got := whole.summarize(nil), first.summarize(nil)
+	for period := range expected {
+		if !closeTo(got[period].ExpensesMean, expected[period].ExpensesMean, 1e-9) || !closeTo(got[period].ExpensesCILow, expected[period].ExpensesCILow, 1e-9) {
+			t.Error("Merged accumulator mismatch for period", period)
+		}
+	}
+}
+
+func TestQuantileSketch(t *testing.T) {
+	rng := rand.New(rand.NewSource(42))
+	values := make([]float64, 5000)
+	first, second := newQuantileSketch(), newQuantileSketch()
+	for i := range values {
+		values[i] = rng.NormFloat64()
+		if i%2 == 0 {
+			first.add(values[i])
+		} else {
+			second.add(values[i])
+		}
+	}
+	first.merge(second)
+	sort.Float64s(values)
+
+	for _, p := range []float64{0.01, 0.05, 0.25, 0.5, 0.75, 0.95, 0.99} {
+		exact := values[int(p*float64(len(values)))]
+		estimate := first.quantile(p)
+		if math.Abs(estimate-exact) > 0.05 {
+			t.Error("Quantile", p, "expected about", exact, "got", estimate)
+		}
+	}
+}
+
+func TestSummaryPercentiles(t *testing.T) {
+	trials := randomTrials(1000, 2)
+
+	accumulator := newSummaryAccumulator(&SimulationData{}, 2)
+	for _, trial := range trials {
+		accumulator.addTrial(trial)
+	}
+	summarized := accumulator.summarize([]float64{5, 50, 95})
+
+	incomes := make([]float64, len(trials))
+	for i, trial := range trials {
+		incomes[i] = trial[0].income
+	}
+	sort.Float64s(incomes)
+
+	bands := summarized[0].IncomePercentiles
+	if len(bands) != 3 {
+		t.Fatal("Expected three percentile bands, got", bands)
+	}
+	if math.Abs(bands["50"]-incomes[500]) > 100 {
+		t.Error("Median expected about", incomes[500], "got", bands["50"])
+	}
+	if !(bands["5"] < bands["50"] && bands["50"] < bands["95"]) {
+		t.Error("Percentile bands out of order", bands)
+	}
+	if accumulator.summarize(nil)[0].IncomePercentiles != nil {
+		t.Error("Expected no bands when none requested")
+	}
+}
+
+func TestSummaryRealDollars(t *testing.T) {
+	trials := randomTrials(50, 3)
+
+	accumulator := newSummaryAccumulator(&SimulationData{RealDollars: true}, 3)
+	for _, trial := range trials {
+		accumulator.addTrial(trial)
+	}
+	summarized := accumulator.summarize(nil)
+
+	for period, step := range summarized {
+		factor := 1 + float64(period)/100
+		if step.Real == nil {
+			t.Fatal("Expected real dollar figures")
+		}
+		if !closeTo(step.Real.AssetsMean, step.AssetsMean/factor, 1e-9) || !closeTo(step.Real.ExpensesCIHigh, step.ExpensesCIHigh/factor, 1e-9) {
+			t.Error("Real figures not deflated for period", period)
+		}
+	}
+
+	if newSummaryAccumulator(&SimulationData{}, 3).summarize(nil)[0].Real != nil {
+		t.Error("Expected no real figures unless requested")
+	}
+}
@@ -0,0 +1,296 @@
+package simulation
+
+import (
+	"encoding/json"
+	"math"
+)
+
+// TaxSettings replaces the flat current / retirement tax rates with
+// progressive bracket schedules. Each person is taxed separately, on their
+// share of the household's income.
+type TaxSettings struct {
+	// A built-in set of schedules (see builtInJurisdictions), e.g. "CA-ON"
+	Jurisdiction string `json:"jurisdiction"`
+
+	// Custom schedules, used if there is no jurisdiction
+	Schedules []TaxSchedule `json:"schedules"`
+
+	// Bracket thresholds are indexed to each trial's inflation, unless fixed
+	FixedBrackets bool `json:"fixed_brackets"`
+
+	// Percentage of employment income earned by the male, if married.
+	// Defaults to 50. Pension income and withdrawals are split evenly.
+	MaleIncomeShare float64 `json:"male_income_share"`
+
+	schedules []taxSchedule // compiled by prepare()
+}
+
+// TaxSchedule is a single set of brackets, e.g. federal or provincial
+type TaxSchedule struct {
+	Name     string       `json:"name"`
+	Brackets []TaxBracket `json:"brackets"` // sorted by threshold
+
+	// Percentage of each income type ("employment", "pension" and
+	// "withdrawal" - from tax-deferred accounts) that is taxable. Defaults to
+	// 100.
+	Inclusion map[string]float64 `json:"inclusion"`
+}
+
+// TaxBracket is the rate paid on annual taxable income (in today's dollars)
+// above the threshold, up to the next bracket's threshold.
+type TaxBracket struct {
+	Threshold float64 `json:"threshold"`
+	Rate      float64 `json:"rate"` // 0 - 100
+}
+
+// Income types, in the order they are held in an incomeByType
+const (
+	employmentIncome = iota
+	pensionIncome
+	withdrawalIncome
+)
+
+var incomeTypeNames = []string{"employment", "pension", "withdrawal"}
+
+// incomeByType is one person's taxable income, split by income type
+type incomeByType [3]float64
+
+// taxSchedule is a TaxSchedule prepared for quick lookups
+type taxSchedule struct {
+	brackets  []TaxBracket
+	inclusion [3]float64 // fraction taxable, by income type
+}
+
+// builtInJurisdictions are 2024 brackets, with the basic personal amount /
+// standard deduction as a 0% bracket. The US schedule uses the single filer
+// brackets per person, and taxes 85% of pension (i.e. social security) income.
+var builtInJurisdictions = mustParseJurisdictions(`{
+	"CA-ON": [
+		{"name": "federal", "brackets": [
+			{"threshold": 0, "rate": 0},
+			{"threshold": 15705, "rate": 15},
+			{"threshold": 55867, "rate": 20.5},
+			{"threshold": 111733, "rate": 26},
+			{"threshold": 173205, "rate": 29},
+			{"threshold": 246752, "rate": 33}
+		]},
+		{"name": "ontario", "brackets": [
+			{"threshold": 0, "rate": 0},
+			{"threshold": 12399, "rate": 5.05},
+			{"threshold": 51446, "rate": 9.15},
+			{"threshold": 102894, "rate": 11.16},
+			{"threshold": 150000, "rate": 12.16},
+			{"threshold": 220000, "rate": 13.16}
+		]}
+	],
+	"US-TX": [
+		{"name": "federal", "inclusion": {"pension": 85}, "brackets": [
+			{"threshold": 0, "rate": 0},
+			{"threshold": 14600, "rate": 10},
+			{"threshold": 26200, "rate": 12},
+			{"threshold": 61750, "rate": 22},
+			{"threshold": 115125, "rate": 24},
+			{"threshold": 206550, "rate": 32},
+			{"threshold": 258325, "rate": 35},
+			{"threshold": 623950, "rate": 37}
+		]}
+	]
+}`)
+
+// mustParseJurisdictions parses the built-in jurisdictions, panicking if they
+// are malformed.
+// Params: tables string -- JSON, schedules keyed by jurisdiction
+// Returns: map[string][]TaxSchedule
+func mustParseJurisdictions(tables string) map[string][]TaxSchedule {
+	jurisdictions := map[string][]TaxSchedule{}
+	if err := json.Unmarshal([]byte(tables), &jurisdictions); err != nil {
+		panic("Invalid built-in tax jurisdictions: " + err.Error())
+	}
+	return jurisdictions
+}
+
+// enabled Determines if progressive taxes should be used instead of the flat
+// rates
+// Receiver: TaxSettings
+// Params: None
+// Returns: bool
+func (t *TaxSettings) enabled() bool {
+	return t.Jurisdiction != "" || len(t.Schedules) > 0
+}
+
+// prepare compiles the schedules for quick lookups. Must be called before
+// trials are run concurrently.
+// Receiver: *TaxSettings
+// Params: None
+// Returns: None
+func (t *TaxSettings) prepare() {
+	schedules := t.Schedules
+	if t.Jurisdiction != "" {
+		schedules = builtInJurisdictions[t.Jurisdiction]
+	}
+
+	t.schedules = make([]taxSchedule, len(schedules))
+	for i, schedule := range schedules {
+		t.schedules[i].brackets = schedule.Brackets
+		for incomeType, name := range incomeTypeNames {
+			inclusion, ok := schedule.Inclusion[name]
+			if !ok {
+				inclusion = 100
+			}
+			t.schedules[i].inclusion[incomeType] = inclusion / 100
+		}
+	}
+}
+
+// personIncomes splits the household's monthly taxable income (plus any
+// tax-deferred withdrawals) between the people alive, and annualizes it.
+// Income streams are taxed as pension income of the person they are paid to.
+// Receiver: TaxSettings
+// Params: s *SimulationData
+// Params: step *simulationTimeStep
+// Params: withdrawals float64 -- from tax-deferred accounts this month
+// Returns: []incomeByType -- one per person alive
+func (t *TaxSettings) personIncomes(s *SimulationData, step *simulationTimeStep, withdrawals float64) []incomeByType {
+	people := make([]int, 0, 2)
+	for _, person := range []int{malePerson, femalePerson} {
+		if personAlive(step, person) {
+			people = append(people, person)
+		}
+	}
+	if len(people) == 0 {
+		return nil
+	}
+	alive := float64(len(people))
+
+	incomeType := employmentIncome
+	if s.householdRetired(step) {
+		incomeType = pensionIncome
+	}
+	householdIncome := step.taxableIncome - step.streamIncome[malePerson] - step.streamIncome[femalePerson]
+
+	incomes := make([]incomeByType, len(people))
+	for i, person := range people {
+		incomes[i][withdrawalIncome] = 12 * withdrawals / alive
+		incomes[i][pensionIncome] = 12 * step.streamIncome[person]
+		if incomeType == pensionIncome {
+			incomes[i][pensionIncome] += 12 * householdIncome / alive
+		}
+	}
+	if incomeType == employmentIncome {
+		if len(people) == 2 {
+			maleShare := orDefault(t.MaleIncomeShare, 50) / 100
+			incomes[0][employmentIncome] = 12 * householdIncome * maleShare
+			incomes[1][employmentIncome] = 12 * householdIncome * (1 - maleShare)
+		} else {
+			incomes[0][employmentIncome] = 12 * householdIncome
+		}
+	}
+	return incomes
+}
+
+// bracketIndex returns how much bracket thresholds have grown by in a time step
+// Receiver: TaxSettings
+// Params: step *simulationTimeStep
+// Returns: float64
+func (t *TaxSettings) bracketIndex(step *simulationTimeStep) float64 {
+	if t.FixedBrackets || step.inflationFactor == 0 {
+		return 1
+	}
+	return step.inflationFactor
+}
+
+// monthlyTax returns the household's tax for a month, on its taxable income
+// plus any tax-deferred withdrawals
+// Receiver: TaxSettings
+// Params: s *SimulationData
+// Params: step *simulationTimeStep
+// Params: withdrawals float64 -- from tax-deferred accounts this month
+// Returns: float64
+func (t *TaxSettings) monthlyTax(s *SimulationData, step *simulationTimeStep, withdrawals float64) float64 {
+	if t.schedules == nil {
+		t.prepare()
+	}
+	index := t.bracketIndex(step)
+	tax := 0.0
+	for _, income := range t.personIncomes(s, step, withdrawals) {
+		for i := range t.schedules {
+			tax += t.schedules[i].annualTax(income, index)
+		}
+	}
+	return tax / 12
+}
+
+// withdrawalRate returns the marginal rate on tax-deferred withdrawals for a
+// month, averaged over the people alive
+// Receiver: TaxSettings
+// Params: s *SimulationData
+// Params: step *simulationTimeStep
+// Returns: float64 -- 0 - 1
+func (t *TaxSettings) withdrawalRate(s *SimulationData, step *simulationTimeStep) float64 {
+	if t.schedules == nil {
+		t.prepare()
+	}
+	index := t.bracketIndex(step)
+	incomes := t.personIncomes(s, step, 0)
+	rate := 0.0
+	for _, income := range incomes {
+		for i := range t.schedules {
+			rate += t.schedules[i].marginalRate(income, index) * t.schedules[i].inclusion[withdrawalIncome]
+		}
+	}
+	if len(incomes) == 0 {
+		return 0
+	}
+	return math.Min(rate/float64(len(incomes)), 1)
+}
+
+// taxableAmount returns the part of a person's income this schedule taxes
+// Receiver: taxSchedule
+// Params: income incomeByType
+// Returns: float64
+func (t *taxSchedule) taxableAmount(income incomeByType) float64 {
+	taxable := 0.0
+	for incomeType, amount := range income {
+		taxable += amount * t.inclusion[incomeType]
+	}
+	return taxable
+}
+
+// annualTax returns the tax on a person's annual income
+// Receiver: taxSchedule
+// Params: income incomeByType -- annual
+// Params: index float64 -- growth in the bracket thresholds
+// Returns: float64
+func (t *taxSchedule) annualTax(income incomeByType, index float64) float64 {
+	taxable := t.taxableAmount(income)
+	tax := 0.0
+	for i, bracket := range t.brackets {
+		lower := bracket.Threshold * index
+		if taxable <= lower {
+			break
+		}
+		upper := taxable
+		if i+1 < len(t.brackets) {
+			upper = math.Min(taxable, t.brackets[i+1].Threshold*index)
+		}
+		tax += (upper - lower) * bracket.Rate / 100
+	}
+	return tax
+}
+
+// marginalRate returns the rate on the next dollar of taxable income
+// Receiver: taxSchedule
+// Params: income incomeByType -- annual
+// Params: index float64 -- growth in the bracket thresholds
+// Returns: float64 -- 0 - 1
+func (t *taxSchedule) marginalRate(income incomeByType, index float64) float64 {
+	taxable := t.taxableAmount(income)
+	rate := 0.0
+	for _, bracket := range t.brackets {
+		if taxable < bracket.Threshold*index {
+			break
+		}
+		rate = bracket.Rate / 100
+	}
+	return rate
+}
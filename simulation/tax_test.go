@@ -0,0 +1,79 @@
+package simulation
+
+import (
+	"context"
+	"testing"
+)
+
+func testTaxSettings() TaxSettings {
+	return TaxSettings{Schedules: []TaxSchedule{
+		TaxSchedule{Name: "test", Inclusion: map[string]float64{"pension": 50}, Brackets: []TaxBracket{
+			TaxBracket{Threshold: 0, Rate: 0},
+			TaxBracket{Threshold: 10000, Rate: 10},
+			TaxBracket{Threshold: 50000, Rate: 40},
+		}},
+	}}
+}
+
+func TestAnnualTax(t *testing.T) {
+	settings := testTaxSettings()
+	settings.prepare()
+	schedule := &settings.schedules[0]
+
+	if tax := schedule.annualTax(incomeByType{60000, 0, 0}, 1); tax != 8000 {
+		t.Error("Expected 4000 + 4000, got", tax)
+	}
+	if tax := schedule.annualTax(incomeByType{0, 60000, 0}, 1); tax != 2000 {
+		t.Error("Expected half of pension income taxed, got", tax)
+	}
+	if tax := schedule.annualTax(incomeByType{60000, 0, 0}, 2); tax != 4000 {
+		t.Error("Expected indexed brackets, got", tax)
+	}
+	if rate := schedule.marginalRate(incomeByType{60000, 0, 0}, 2); rate != 0.1 {
+		t.Error("Expected a marginal rate of 10% with indexed brackets, got", rate)
+	}
+}
+
+func TestMonthlyTaxIsPerPerson(t *testing.T) {
+	s := &SimulationData{Parameters: Parameters{Married: true, Male: true, RetirementAgeMale: 65, RetirementAgeFemale: 65}}
+	s.Tax = testTaxSettings()
+	step := &simulationTimeStep{taxableIncome: 5000, inflationFactor: 1, maleAlive: true, femaleAlive: true}
+
+	// 30000 each a year
+	if tax := s.Tax.monthlyTax(s, step, 0); !closeTo(tax, 2*2000.0/12, 1e-9) {
+		t.Error("Expected income split evenly, got", tax)
+	}
+
+	s.Tax.MaleIncomeShare = 100
+	if tax := s.Tax.monthlyTax(s, step, 0); !closeTo(tax, 8000.0/12, 1e-9) {
+		t.Error("Expected all income taxed as the male's, got", tax)
+	}
+
+	step.femaleAlive = false
+	if rate := s.Tax.withdrawalRate(s, step); rate != 0.4 {
+		t.Error("Expected the survivor's marginal rate, got", rate)
+	}
+}
+
+func TestBuiltInJurisdictions(t *testing.T) {
+	for _, jurisdiction := range []string{"CA-ON", "US-TX"} {
+		if len(builtInJurisdictions[jurisdiction]) == 0 {
+			t.Error("Missing built-in jurisdiction", jurisdiction)
+		}
+	}
+}
+
+func TestSimulateWithTaxBrackets(t *testing.T) {
+	s := validSimulationData()
+	s.Tax = TaxSettings{Jurisdiction: "CA-ON"}
+
+	results, err := Simulate(context.Background(), s, DefaultLimits())
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := results.Timesteps[0]
+	effectiveRate := first.TaxesMean / (first.TaxesMean + first.IncomeMean)
+	if effectiveRate < 0.15 || effectiveRate > 0.3 {
+		t.Error("Expected an effective rate on 60000 each of 15 - 30%, got", effectiveRate)
+	}
+}
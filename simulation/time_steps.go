@@ -6,11 +6,18 @@ import (
 	goMoment "github.com/jinzhu/now"
 )
 
+// now is the clock used when a simulation has no start date. Tests replace it
+// to get a fixed date.
+var now = time.Now
+
 type timeList []time.Time
 
 type timeStep struct {
-	date     int
-	expenses float64
+	date          int
+	expenses      float64
+	contributions []float64 // by account, in the order of SimulationData.Accounts
+
+	extraDebtPayments []float64 // by debt, in the order of SimulationData.Debts
 }
 
 // dateToTime Converts an integer time (UTC) to a time.Time
@@ -29,16 +36,18 @@ func dateToInt(regularTimeType time.Time) int {
 	return int(regularTimeType.Unix())
 }
 
-// generateMonthsList returns a list of months (end of month), length per arg
+// generateMonthsList returns a list of months (end of month), length per arg,
+// starting with the month containing the start date.
 // Receiver: None
+// Params: startDate -- time.Time
 // Params: numberOfMonths -- integer
 // Returns: timeList ([]time.Time)
-func generateMonthsList(numberOfMonths int) timeList {
+func generateMonthsList(startDate time.Time, numberOfMonths int) timeList {
 	goMoment.FirstDayMonday = true
 
 	// Do everything in UTC, otherwise you get messed up EndOfMonth's on days
 	// where daylight savings time switches
-	endofThisMonth := goMoment.New(time.Now().UTC()).EndOfMonth()
+	endofThisMonth := goMoment.New(startDate.UTC()).EndOfMonth()
 
 	monthsList := make(timeList, numberOfMonths)
 	onMonth := endofThisMonth
@@ -51,6 +60,18 @@ func generateMonthsList(numberOfMonths int) timeList {
 	return monthsList
 }
 
+// startDate returns the date the simulation starts on - the provided
+// start_date, or today if there isn't one.
+// Receiver: SimulationData
+// Params: None
+// Returns: time.Time (UTC)
+func (s *SimulationData) startDate() time.Time {
+	if s.StartDate != 0 {
+		return dateToTime(s.StartDate)
+	}
+	return now().UTC()
+}
+
 // moveDateToEndOfMonth moves any date to the end of its respective month
 // Receiver: None
 // Params: date time.Time -- original date
@@ -158,15 +179,47 @@ func applyOnetimeExpenses(timeSteps []*timeStep, onetimeExpenses []Expense) []*t
 
 // applyExpenses pulls the array of expenses present in the simulationData struct
 // and builds out the simulation timeSteps, applying weekly/monthly/annual/onetime
-// expenses as appropriate.
+// expenses as appropriate. Account contributions and extra debt payments are
+// scheduled the same way.
 // Params: numberOfMonths int -- how many months to simulate
 // Returns: []timeStep
 func (s *SimulationData) applyExpenses(numberOfMonths int) []*timeStep {
 	// This is called ONCE at the beginning of a set of simulation trials. Do
 	// **not** do any run-specific calculations here.
+	timeSteps := s.scheduleTimeSteps(s.Expenses, numberOfMonths)
+
+	for _, step := range timeSteps {
+		step.contributions = make([]float64, len(s.Accounts))
+	}
+	for accountIndex, account := range s.Accounts {
+		contributions := s.scheduleTimeSteps(account.Contributions, numberOfMonths)
+		for monthIndex, step := range timeSteps {
+			step.contributions[accountIndex] = contributions[monthIndex].expenses
+		}
+	}
 
+	for _, step := range timeSteps {
+		step.extraDebtPayments = make([]float64, len(s.Debts))
+	}
+	for debtIndex, debt := range s.Debts {
+		extraPayments := s.scheduleTimeSteps(debt.ExtraPayments, numberOfMonths)
+		for monthIndex, step := range timeSteps {
+			step.extraDebtPayments[debtIndex] = extraPayments[monthIndex].expenses
+		}
+	}
+
+	return timeSteps
+}
+
+// scheduleTimeSteps builds out a set of timeSteps with a schedule of amounts
+// (expenses, contributions) applied to them.
+// Receiver: SimulationData
+// Params: schedule []Expense -- amounts and frequencies to apply
+// Params: numberOfMonths int -- how many months to simulate
+// Returns: []*timeStep
+func (s *SimulationData) scheduleTimeSteps(schedule []Expense, numberOfMonths int) []*timeStep {
 	// Initialize the timesteps
-	months := generateMonthsList(numberOfMonths)
+	months := generateMonthsList(s.startDate(), numberOfMonths)
 	timeSteps := make([]*timeStep, numberOfMonths)
 	for monthIndex, month := range months {
 		step := &timeStep{
@@ -177,7 +230,7 @@ func (s *SimulationData) applyExpenses(numberOfMonths int) []*timeStep {
 	}
 
 	// Split expenses into buckets
-	arrangedExpenses := filterExpenses(s.Expenses)
+	arrangedExpenses := filterExpenses(schedule)
 
 	// Apply expenses to the timesteps.
 	// Doing it this way instead of looping over expenses and applying expenses
@@ -29,7 +29,33 @@ func TestDateToInt(t *testing.T) {
 }
 
 func TestGenerateMonthsList(t *testing.T) {
-	t.Skip("Pending....")
+	start := dateToTime(1405036800) // Jul-11-2014
+	months := generateMonthsList(start, 7)
+
+	if len(months) != 7 {
+		t.Error("Expected 7 months, got", len(months))
+	}
+	if dateToInt(months[0]) != 1406851199 { // Jul-31-2014
+		t.Error("Expected to start at end of July, got", months[0])
+	}
+	if !isYearEnd(months[5]) {
+		t.Error("Expected Dec-31-2014, got", months[5])
+	}
+}
+
+func TestStartDateDefaultsToClock(t *testing.T) {
+	defer func(original func() time.Time) { now = original }(now)
+	now = func() time.Time { return dateToTime(1405036800) }
+
+	s := &SimulationData{}
+	if dateToInt(s.startDate()) != 1405036800 {
+		t.Error("Expected the clock to be used, got", s.startDate())
+	}
+
+	s.StartDate = 1388534400
+	if dateToInt(s.startDate()) != 1388534400 {
+		t.Error("Expected the start date to be used, got", s.startDate())
+	}
 }
 func TestMoveDateToEndOfMonth(t *testing.T) {
 	t.Skip("Pending....")
@@ -195,5 +221,29 @@ func TestApplyOnetimeExpenses(t *testing.T) {
 }
 
 func TestApplyExpenses(t *testing.T) {
-	t.Skip("Pending....")
+	s := &SimulationData{
+		StartDate: 1405036800, // Jul-11-2014
+		Expenses: []Expense{
+			Expense{Amount: 300, Frequency: "monthly", OneTimeOn: 0, Ends: 1412121599},   // Sep 30, 2014
+			Expense{Amount: 5000, Frequency: "annual", OneTimeOn: 0, Ends: 0},            // Every Dec
+			Expense{Amount: 25000, Frequency: "onetime", OneTimeOn: 1409529599, Ends: 0}, // Aug 31, 2014
+			Expense{Amount: 100, Frequency: "weekly", OneTimeOn: 0, Ends: 1406851199},    // Jul 31, 2014
+		},
+	}
+
+	applied := s.applyExpenses(7)
+	weekly := 100 * (52.0 / 12)
+
+	if applied[0].date != 1406851199 || applied[0].expenses != 300+weekly {
+		t.Error("Messed up July!", applied[0])
+	}
+	if applied[1].expenses != 300+25000 {
+		t.Error("Messed up August!", applied[1])
+	}
+	if applied[2].expenses != 300 || applied[3].expenses != 0 {
+		t.Error("Messed up Sep/Oct!", applied[2], applied[3])
+	}
+	if applied[5].expenses != 5000 {
+		t.Error("Messed up December!", applied[5])
+	}
 }
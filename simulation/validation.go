@@ -0,0 +1,926 @@
+package simulation
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// Error codes returned in ValidationError.Code. These are part of the API
+// contract with the Rails server, so treat them as stable.
+const (
+	errCodeRequired     = "required"
+	errCodeOutOfRange   = "out_of_range"
+	errCodeInvalid      = "invalid"
+	errCodeMismatch     = "mismatch"
+	errCodeUnknownAsset = "unknown_asset"
+)
+
+// weightSumTolerance is how far the portfolio weights may stray from 1.0 before
+// they are rejected (Rails sends floats that don't always sum exactly).
+const weightSumTolerance = 1e-6
+
+// ValidationError describes a single problem with the posted simulation data.
+// Field is the JSON path of the offending value.
+type ValidationError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type validationErrors []ValidationError
+
+// add appends a new error to the list
+// Receiver: *validationErrors
+// Params: field, code string; format string, args ...interface{} -- message
+// Returns: None
+func (v *validationErrors) add(field, code, format string, args ...interface{}) {
+	*v = append(*v, ValidationError{
+		Field:   field,
+		Code:    code,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// checkPercentage adds an error if value is not within 0 - 100
+// Receiver: *validationErrors
+// Params: field string, value float64
+// Returns: None
+func (v *validationErrors) checkPercentage(field string, value float64) {
+	if value < 0 || value > 100 {
+		v.add(field, errCodeOutOfRange, "must be between 0 and 100, got %v", value)
+	}
+}
+
+// checkNonNegative adds an error if value is below zero
+// Receiver: *validationErrors
+// Params: field string, value float64
+// Returns: None
+func (v *validationErrors) checkNonNegative(field string, value float64) {
+	if value < 0 {
+		v.add(field, errCodeOutOfRange, "must not be negative, got %v", value)
+	}
+}
+
+// checkAge adds an error if age is outside of the mortality table. If
+// required, zero is also rejected (zero means "not provided" elsewhere).
+// Receiver: *validationErrors
+// Params: field string, age int, required bool
+// Returns: None
+func (v *validationErrors) checkAge(field string, age int, required bool) {
+	maxAge := len(mortalityTable) - 1
+	if required && age == 0 {
+		v.add(field, errCodeRequired, "is required")
+		return
+	}
+	if age < 0 || age > maxAge {
+		v.add(field, errCodeOutOfRange, "must be between 0 and %d, got %d", maxAge, age)
+	}
+}
+
+// Validate checks every field of the simulation data, and returns a list of
+// everything that is wrong with it. An empty list means the data is safe to
+// pass to Simulate().
+// Receiver: SimulationData
+// Params: None
+// Returns: []ValidationError
+func (s *SimulationData) Validate() []ValidationError {
+	errs := validationErrors{}
+
+	switch s.Mode {
+	case "", monteCarloMode:
+		if s.NumberOfTrials <= 0 {
+			errs.add("number_of_trials", errCodeOutOfRange, "must be greater than 0, got %d", s.NumberOfTrials)
+		}
+	case backtestMode: // one trial per start month
+	default:
+		errs.add("mode", errCodeInvalid, "must be one of %s or %s, got %q", monteCarloMode, backtestMode, s.Mode)
+	}
+
+	s.validateParameters(&errs)
+	s.validateDistributions(&errs)
+	s.validatePortfolio(&errs)
+	s.validateExpenses(&errs)
+	s.validateAccounts(&errs)
+	s.validateGlidePath(&errs)
+	s.validateFees(&errs)
+	s.validateProperties(&errs)
+	s.validateDebts(&errs)
+	s.validateSpendingPolicy(&errs)
+	s.validateTax(&errs)
+	s.validateIncomeStreams(&errs)
+	s.validateReturnModel(&errs)
+
+	for i, p := range s.Percentiles {
+		if p <= 0 || p >= 100 {
+			errs.add(fmt.Sprintf("percentiles[%d]", i), errCodeOutOfRange, "must be between 0 and 100 (exclusive), got %v", p)
+		}
+	}
+
+	return errs
+}
+
+// validateParameters checks the user's personal/financial parameters
+// Receiver: SimulationData
+// Params: errs *validationErrors
+// Returns: None
+func (s *SimulationData) validateParameters(errs *validationErrors) {
+	p := s.Parameters
+
+	maleRequired := p.Married || p.Male
+	femaleRequired := p.Married || !p.Male
+	errorsBeforeAges := len(*errs)
+	errs.checkAge("simulation_parameters.male_age", p.MaleAge, maleRequired)
+	errs.checkAge("simulation_parameters.female_age", p.FemaleAge, femaleRequired)
+	errs.checkAge("simulation_parameters.retirement_age_male", p.RetirementAgeMale, false)
+	errs.checkAge("simulation_parameters.retirement_age_female", p.RetirementAgeFemale, false)
+	s.validateHorizon(errs)
+	horizonIsValid := len(*errs) == errorsBeforeAges
+
+	errs.checkPercentage("simulation_parameters.fraction_single_income", p.FractionSingleIncome)
+	errs.checkPercentage("simulation_parameters.current_tax", p.CurrentTax)
+	errs.checkPercentage("simulation_parameters.retirement_tax", p.RetirementTax)
+	errs.checkPercentage("simulation_parameters.income_inflation_index", p.IncomeInflationIndex)
+	errs.checkPercentage("simulation_parameters.expenses_inflation_index", p.ExpensesInflationIndex)
+	errs.checkPercentage("simulation_parameters.new_home_relative_value", p.NewHomeRelVal)
+
+	errs.checkNonNegative("simulation_parameters.expenses_multiplier", p.ExpensesMultiplier)
+	errs.checkNonNegative("simulation_parameters.retirement_expenses", p.RetirementExpenses)
+	errs.checkNonNegative("simulation_parameters.income", p.Income)
+	errs.checkNonNegative("simulation_parameters.retirement_income", p.RetirementIncome)
+	errs.checkNonNegative("simulation_parameters.life_insurance", p.LifeInsurance)
+	errs.checkNonNegative("simulation_parameters.legacy_target", p.LegacyTarget)
+
+	if p.IncludeHome {
+		errs.checkNonNegative("simulation_parameters.home_value", p.HomeValue)
+
+		// Only check if the horizon (and the ages it depends on) are usable.
+		if horizonIsValid {
+			numberOfYears := numberOfMonthsToSimulate(s) / 12
+			if p.SellHouseIn < 0 || p.SellHouseIn >= numberOfYears {
+				errs.add("simulation_parameters.sell_house_in", errCodeOutOfRange, "must be between 0 and %d years, got %d", numberOfYears-1, p.SellHouseIn)
+			}
+		}
+	}
+}
+
+// validateHorizon checks the start date and horizon. Assumes the ages have
+// already been checked.
+// Receiver: SimulationData
+// Params: errs *validationErrors
+// Returns: None
+func (s *SimulationData) validateHorizon(errs *validationErrors) {
+	if s.StartDate < 0 {
+		errs.add("start_date", errCodeOutOfRange, "must not be negative, got %d", s.StartDate)
+	}
+
+	maxAge := len(mortalityTable) - 1
+	switch s.Horizon.Type {
+	case "", "last_survivor":
+		// Runs until the youngest reaches the end of the mortality table
+		if numberOfMonthsToSimulate(s) < 1 {
+			errs.add("horizon", errCodeOutOfRange, "must cover at least one month - the youngest person must be under %d", maxAge)
+		}
+	case "years":
+		if s.Horizon.Value <= 0 || s.Horizon.Value > maxAge {
+			errs.add("horizon.value", errCodeOutOfRange, "must be between 1 and %d years, got %d", maxAge, s.Horizon.Value)
+		}
+	case "age":
+		if s.Horizon.Value <= s.primaryAge() || s.Horizon.Value > maxAge {
+			errs.add("horizon.value", errCodeOutOfRange, "must be an age between %d and %d, got %d", s.primaryAge()+1, maxAge, s.Horizon.Value)
+		}
+	default:
+		errs.add("horizon.type", errCodeInvalid, "must be one of years, age or last_survivor, got %q", s.Horizon.Type)
+	}
+}
+
+// validateDistributions checks the inflation, real estate and asset class
+// return distributions
+// Receiver: SimulationData
+// Params: errs *validationErrors
+// Returns: None
+func (s *SimulationData) validateDistributions(errs *validationErrors) {
+	validateDistribution(errs, "inflation", s.Inflation.Distribution)
+	switch s.Inflation.Model {
+	case "", iidInflation:
+	case ar1Inflation:
+		if s.Inflation.Persistence < 0 || s.Inflation.Persistence >= 1 {
+			errs.add("inflation.persistence", errCodeOutOfRange, "must be at least 0 and less than 1, got %v", s.Inflation.Persistence)
+		}
+	default:
+		errs.add("inflation.model", errCodeInvalid, "must be one of %s or %s, got %q", iidInflation, ar1Inflation, s.Inflation.Model)
+	}
+	if s.Inflation.Correlated && s.ReturnModel.name() != defaultReturnModel {
+		errs.add("inflation.correlated", errCodeInvalid, "is only supported by the %s return model", defaultReturnModel)
+	}
+	validateDistribution(errs, "real_estate", s.RealEstate)
+	for _, assetClassId := range sortedKeys(s.AssetPerformanceData) {
+		validateDistribution(errs, "asset_performance_data."+assetClassId, s.AssetPerformanceData[assetClassId])
+	}
+}
+
+// validateDistribution checks a single distribution's std dev and shock shape
+// Params: errs *validationErrors
+// Params: field string -- field the distribution is in, e.g. "inflation"
+// Params: d Distribution
+// Returns: None
+func validateDistribution(errs *validationErrors, field string, d Distribution) {
+	errs.checkNonNegative(field+".std_dev", d.StdDev)
+
+	switch d.Shock {
+	case "", normalShock, skewNormalShock:
+	case studentTShock:
+		if d.DegreesOfFreedom != 0 && d.DegreesOfFreedom <= 2 {
+			errs.add(field+".degrees_of_freedom", errCodeOutOfRange, "must be greater than 2, got %v", d.DegreesOfFreedom)
+		}
+	default:
+		errs.add(field+".shock", errCodeInvalid, "must be one of %s, got %q", strings.Join(shockTypes, ", "), d.Shock)
+	}
+}
+
+// validatePortfolio checks the selected portfolio weights against the asset
+// performance data and the cholesky decomposition
+// Receiver: SimulationData
+// Params: errs *validationErrors
+// Returns: None
+func (s *SimulationData) validatePortfolio(errs *validationErrors) {
+	assetClassIds := s.assetClassIds()
+
+	// Only the lognormal model draws from the distributions. Other models
+	// check their own inputs.
+	usesDistributions := s.ReturnModel.name() == defaultReturnModel && !s.backtesting()
+
+	if len(assetClassIds) == 0 {
+		errs.add("selected_portfolio_weights", errCodeRequired, "at least one asset class is required")
+	}
+
+	weightSum := 0.0
+	for _, assetClassId := range assetClassIds {
+		field := "selected_portfolio_weights." + assetClassId
+		weight := s.SelectedPortfolioWeights[assetClassId]
+		if weight < 0 || weight > 1 {
+			errs.add(field, errCodeOutOfRange, "must be between 0 and 1, got %v", weight)
+		}
+		if _, ok := s.AssetPerformanceData[assetClassId]; !ok && usesDistributions {
+			errs.add(field, errCodeUnknownAsset, "no asset_performance_data provided for %s", assetClassId)
+		}
+		weightSum += weight
+	}
+	if len(assetClassIds) > 0 && math.Abs(weightSum-1) > weightSumTolerance {
+		errs.add("selected_portfolio_weights", errCodeInvalid, "weights must sum to 1, got %v", weightSum)
+	}
+
+	if !usesDistributions {
+		return
+	}
+
+	if s.CorrelationMatrix != nil {
+		if len(s.CholeskyDecomposition) > 0 {
+			errs.add("cholesky_decomposition", errCodeInvalid, "can't be given with correlation_matrix")
+		}
+		s.validateCorrelationMatrix(errs)
+		return
+	}
+
+	size := len(assetClassIds)
+	if s.Inflation.Correlated {
+		size++ // plus a row and column for inflation
+	}
+	validateCholesky(errs, "cholesky_decomposition", s.CholeskyDecomposition, size)
+}
+
+// validateCorrelationMatrix checks the correlation matrix has a row and column
+// for each asset class selected (and inflation, if correlated), is symmetric,
+// and can be decomposed
+// Receiver: SimulationData
+// Params: errs *validationErrors
+// Returns: None
+func (s *SimulationData) validateCorrelationMatrix(errs *validationErrors) {
+	c := s.CorrelationMatrix
+	switch c.Type {
+	case "", correlationMatrix, covarianceMatrix:
+	default:
+		errs.add("correlation_matrix.type", errCodeInvalid, "must be one of %s or %s, got %q", correlationMatrix, covarianceMatrix, c.Type)
+		return
+	}
+
+	keys := s.correlationKeys()
+	if len(c.Values) != len(keys) {
+		errs.add("correlation_matrix.values", errCodeMismatch, "has %d rows but must have %d for the asset classes selected", len(c.Values), len(keys))
+		return
+	}
+	errorsBefore := len(*errs)
+	for _, row := range keys {
+		field := "correlation_matrix.values." + row
+		values, ok := c.Values[row]
+		if !ok {
+			errs.add(field, errCodeMismatch, "is required for the asset classes selected")
+			continue
+		}
+		if len(values) != len(keys) {
+			errs.add(field, errCodeMismatch, "has %d columns but must have %d for the asset classes selected", len(values), len(keys))
+			continue
+		}
+		for _, column := range keys {
+			if _, ok := values[column]; !ok {
+				errs.add(field+"."+column, errCodeMismatch, "is required for the asset classes selected")
+			}
+		}
+	}
+	if len(*errs) != errorsBefore {
+		return
+	}
+
+	for i, row := range keys {
+		for _, column := range keys[:i+1] {
+			field := "correlation_matrix.values." + row + "." + column
+			value := c.Values[row][column]
+			switch {
+			case math.Abs(value-c.Values[column][row]) > symmetryTolerance:
+				errs.add(field, errCodeInvalid, "must equal %s.%s, got %v", column, row, value)
+			case row == column && c.Type == covarianceMatrix && value <= 0:
+				errs.add(field, errCodeOutOfRange, "must be greater than 0, got %v", value)
+			case row == column && c.Type != covarianceMatrix && math.Abs(value-1) > symmetryTolerance:
+				errs.add(field, errCodeOutOfRange, "must be 1, got %v", value)
+			case row != column && c.Type != covarianceMatrix && (value < -1 || value > 1):
+				errs.add(field, errCodeOutOfRange, "must be between -1 and 1, got %v", value)
+			}
+		}
+	}
+	if len(*errs) != errorsBefore {
+		return
+	}
+
+	if _, err := c.cholesky(keys); err != nil && c.Repair {
+		errs.add("correlation_matrix", errCodeInvalid, "must be positive definite, and couldn't be repaired")
+	} else if err != nil {
+		errs.add("correlation_matrix", errCodeInvalid, "must be positive definite (or set repair)")
+	}
+}
+
+// validateCholesky checks a cholesky decomposition is a square matrix of the
+// expected size
+// Params: errs *validationErrors
+// Params: field string -- field the matrix is in
+// Params: values []float64 -- the matrix, flattened
+// Params: expectedSize int -- rows needed, e.g. one per asset class selected
+// Returns: None
+func validateCholesky(errs *validationErrors, field string, values []float64, expectedSize int) {
+	numberOfValues := len(values)
+	size := int(math.Sqrt(float64(numberOfValues)))
+	if numberOfValues == 0 {
+		errs.add(field, errCodeRequired, "is required")
+	} else if size*size != numberOfValues {
+		errs.add(field, errCodeInvalid, "length must be a perfect square, got %d", numberOfValues)
+	} else if size != expectedSize {
+		errs.add(field, errCodeMismatch, "is %dx%d but must be %dx%d for the asset classes selected", size, size, expectedSize, expectedSize)
+	}
+}
+
+// validateReturnModel checks the return model is known, and for the bootstrap
+// model or backtests, that there is a history covering every asset class
+// selected
+// Receiver: SimulationData
+// Params: errs *validationErrors
+// Returns: None
+func (s *SimulationData) validateReturnModel(errs *validationErrors) {
+	if _, ok := returnModels[s.ReturnModel.name()]; !ok {
+		errs.add("return_model.type", errCodeInvalid, "must be one of %s, got %q", strings.Join(returnModelNames(), ", "), s.ReturnModel.Type)
+		return
+	}
+	if s.ReturnModel.BlockLength < 0 {
+		errs.add("return_model.block_length", errCodeOutOfRange, "must not be negative, got %d", s.ReturnModel.BlockLength)
+	}
+	if s.ReturnModel.name() == bootstrapReturnModel || s.backtesting() {
+		s.validateReturnHistory(errs)
+	} else if s.ReturnModel.name() == regimeSwitchingReturnModel {
+		s.validateRegimes(errs)
+	}
+}
+
+// validateRegimes checks the regime switching model's regimes and transition
+// matrix
+// Receiver: SimulationData
+// Params: errs *validationErrors
+// Returns: None
+func (s *SimulationData) validateRegimes(errs *validationErrors) {
+	settings := s.ReturnModel
+	numberOfRegimes := len(settings.Regimes)
+	if numberOfRegimes < 2 {
+		errs.add("return_model.regimes", errCodeRequired, "at least two regimes are required, got %d", numberOfRegimes)
+		return
+	}
+
+	assetClassIds := s.assetClassIds()
+	names := map[string]bool{}
+	for i, regime := range settings.Regimes {
+		field := fmt.Sprintf("return_model.regimes[%d]", i)
+		if regime.Name == "" {
+			errs.add(field+".name", errCodeRequired, "is required")
+		} else if names[regime.Name] {
+			errs.add(field+".name", errCodeInvalid, "must be unique, got %q more than once", regime.Name)
+		}
+		names[regime.Name] = true
+
+		for _, assetClassId := range assetClassIds {
+			distribution, ok := regime.AssetPerformanceData[assetClassId]
+			if !ok {
+				errs.add(field+".asset_performance_data."+assetClassId, errCodeUnknownAsset, "no asset_performance_data provided for %s", assetClassId)
+				continue
+			}
+			validateDistribution(errs, field+".asset_performance_data."+assetClassId, distribution)
+		}
+		validateCholesky(errs, field+".cholesky_decomposition", regime.CholeskyDecomposition, len(assetClassIds))
+	}
+
+	if len(settings.Transitions) != numberOfRegimes {
+		errs.add("return_model.transitions", errCodeMismatch, "must have a row for each of the %d regimes, got %d", numberOfRegimes, len(settings.Transitions))
+	}
+	for i, row := range settings.Transitions {
+		field := fmt.Sprintf("return_model.transitions[%d]", i)
+		if len(row) != numberOfRegimes {
+			errs.add(field, errCodeMismatch, "must have a probability for each of the %d regimes, got %d", numberOfRegimes, len(row))
+			continue
+		}
+		sum := 0.0
+		for j, probability := range row {
+			if probability < 0 || probability > 1 {
+				errs.add(fmt.Sprintf("%s[%d]", field, j), errCodeOutOfRange, "must be between 0 and 1, got %v", probability)
+			}
+			sum += probability
+		}
+		if math.Abs(sum-1) > weightSumTolerance {
+			errs.add(field, errCodeInvalid, "probabilities must sum to 1, got %v", sum)
+		}
+	}
+
+	if settings.InitialRegime < 0 || settings.InitialRegime >= numberOfRegimes {
+		errs.add("return_model.initial_regime", errCodeOutOfRange, "must be between 0 and %d, got %d", numberOfRegimes-1, settings.InitialRegime)
+	}
+	if settings.SampleRegimePaths < 0 {
+		errs.add("return_model.sample_regime_paths", errCodeOutOfRange, "must not be negative, got %d", settings.SampleRegimePaths)
+	}
+}
+
+// validateReturnHistory checks the history used by the bootstrap model or
+// backtests
+// Receiver: SimulationData
+// Params: errs *validationErrors
+// Returns: None
+func (s *SimulationData) validateReturnHistory(errs *validationErrors) {
+	history := s.returnHistory()
+	if history == nil {
+		errs.add("return_model.history", errCodeRequired, "is required, no default history is loaded")
+		return
+	}
+	months := history.months()
+	checkSeries := func(field string, series []float64) {
+		if len(series) != months {
+			errs.add(field, errCodeMismatch, "has %d months but inflation has %d", len(series), months)
+			return
+		}
+		for i, r := range series {
+			if r <= -1 {
+				errs.add(fmt.Sprintf("%s[%d]", field, i), errCodeOutOfRange, "must be greater than -1, got %v", r)
+				return
+			}
+		}
+	}
+
+	if months == 0 {
+		errs.add("return_model.history.inflation", errCodeRequired, "at least one month is required")
+		return
+	}
+	checkSeries("return_model.history.inflation", history.Inflation)
+	if history.RealEstate != nil || s.Parameters.IncludeHome {
+		checkSeries("return_model.history.real_estate", history.RealEstate)
+	}
+	for _, assetClassId := range s.assetClassIds() {
+		field := "return_model.history.assets." + assetClassId
+		series, ok := history.Assets[assetClassId]
+		if !ok {
+			errs.add(field, errCodeUnknownAsset, "no history provided for %s", assetClassId)
+			continue
+		}
+		checkSeries(field, series)
+	}
+	if history.Months != nil && len(history.Months) != months {
+		errs.add("return_model.history.months", errCodeMismatch, "has %d labels but inflation has %d months", len(history.Months), months)
+	}
+
+	if numberOfMonths := numberOfMonthsToSimulate(s); s.backtesting() && months < numberOfMonths {
+		errs.add("return_model.history", errCodeOutOfRange, "has %d months, fewer than the %d simulated - shorten the horizon to backtest", months, numberOfMonths)
+	}
+}
+
+// validateExpenses checks each expense's amount, frequency and dates
+// Receiver: SimulationData
+// Params: errs *validationErrors
+// Returns: None
+func (s *SimulationData) validateExpenses(errs *validationErrors) {
+	validateSchedule(errs, "expenses", s.Expenses)
+}
+
+// validateSchedule checks the amount, frequency and dates of each entry in a
+// list of expenses (or anything else scheduled the same way)
+// Params: errs *validationErrors
+// Params: field string -- field the list is in, e.g. "expenses"
+// Params: schedule []Expense
+// Returns: None
+func validateSchedule(errs *validationErrors, field string, schedule []Expense) {
+	for i, expense := range schedule {
+		prefix := fmt.Sprintf("%s[%d].", field, i)
+
+		errs.checkNonNegative(prefix+"amount", expense.Amount)
+
+		if !(expense.isWeekly() || expense.isMonthly() || expense.isAnnual() || expense.isOnetime()) {
+			errs.add(prefix+"frequency", errCodeInvalid, "must be one of weekly, monthly, annual or onetime, got %q", expense.Frequency)
+		}
+		if expense.isOnetime() && expense.OneTimeOn <= 0 {
+			errs.add(prefix+"onetime_on", errCodeRequired, "is required for onetime expenses")
+		}
+		if expense.Ends < 0 {
+			errs.add(prefix+"ends", errCodeOutOfRange, "must not be negative, got %d", expense.Ends)
+		}
+	}
+}
+
+// validateAccounts checks each account's id, balance, tax treatment, portfolio
+// and contributions, and the withdrawal strategy
+// Receiver: SimulationData
+// Params: errs *validationErrors
+// Returns: None
+func (s *SimulationData) validateAccounts(errs *validationErrors) {
+	if len(s.Accounts) > 0 && s.Parameters.StartingAssets != 0 {
+		errs.add("simulation_parameters.starting_assets", errCodeInvalid, "can't be given with accounts - put the assets in an account")
+	}
+
+	seenIds := map[string]bool{}
+	for i, account := range s.Accounts {
+		prefix := fmt.Sprintf("accounts[%d].", i)
+
+		if account.Id == "" {
+			errs.add(prefix+"id", errCodeRequired, "is required")
+		} else if seenIds[account.Id] {
+			errs.add(prefix+"id", errCodeInvalid, "must be unique, %q is used more than once", account.Id)
+		}
+		seenIds[account.Id] = true
+
+		errs.checkNonNegative(prefix+"balance", account.Balance)
+
+		switch account.TaxTreatment {
+		case taxable, taxDeferred, taxFree:
+		default:
+			errs.add(prefix+"tax_treatment", errCodeInvalid, "must be one of taxable, tax_deferred or tax_free, got %q", account.TaxTreatment)
+		}
+
+		if len(account.PortfolioWeights) > 0 {
+			s.validateWeights(errs, prefix+"portfolio_weights", account.PortfolioWeights)
+		}
+
+		validateSchedule(errs, prefix+"contributions", account.Contributions)
+	}
+
+	switch s.Rebalancing.Type {
+	case "", "monthly", "quarterly", "annual", "bands", "never":
+	default:
+		errs.add("rebalancing.type", errCodeInvalid, "must be one of %s, got %q", strings.Join(rebalancingTypes, ", "), s.Rebalancing.Type)
+	}
+	errs.checkPercentage("rebalancing.tolerance", s.Rebalancing.Tolerance)
+	errs.checkPercentage("rebalancing.transaction_cost", s.Rebalancing.TransactionCost)
+
+	if _, ok := withdrawalStrategies[s.WithdrawalStrategy.name()]; !ok {
+		errs.add("withdrawal_strategy.type", errCodeInvalid, "must be one of proportional, taxable_first, tax_deferred_first or bracket_filling, got %q", s.WithdrawalStrategy.Type)
+	}
+	errs.checkNonNegative("withdrawal_strategy.bracket_ceiling", s.WithdrawalStrategy.BracketCeiling)
+}
+
+// validateWeights checks a portfolio's weights are between 0 and 1, sum to 1,
+// and are only for asset classes in the selected portfolio
+// Receiver: SimulationData
+// Params: errs *validationErrors
+// Params: field string -- the weights' field name
+// Params: weights map[string]float64
+// Returns: None
+func (s *SimulationData) validateWeights(errs *validationErrors, field string, weights map[string]float64) {
+	weightSum := 0.0
+	for _, assetClassId := range sortedWeightKeys(weights) {
+		weight := weights[assetClassId]
+		if weight < 0 || weight > 1 {
+			errs.add(field+"."+assetClassId, errCodeOutOfRange, "must be between 0 and 1, got %v", weight)
+		}
+		if _, ok := s.SelectedPortfolioWeights[assetClassId]; !ok {
+			errs.add(field+"."+assetClassId, errCodeUnknownAsset, "%s is not in selected_portfolio_weights", assetClassId)
+		}
+		weightSum += weight
+	}
+	if math.Abs(weightSum-1) > weightSumTolerance {
+		errs.add(field, errCodeInvalid, "weights must sum to 1, got %v", weightSum)
+	}
+}
+
+// validateGlidePath checks the glide path's basis, and its waypoints or preset
+// Receiver: SimulationData
+// Params: errs *validationErrors
+// Returns: None
+func (s *SimulationData) validateGlidePath(errs *validationErrors) {
+	g := s.GlidePath
+	if !g.enabled() {
+		return
+	}
+
+	if g.Preset != "" {
+		if _, ok := glidePathPresets[g.Preset]; !ok {
+			errs.add("glide_path.preset", errCodeInvalid, "must be one of %s, got %q", strings.Join(glidePathPresetNames(), ", "), g.Preset)
+		}
+		if len(g.Waypoints) > 0 {
+			errs.add("glide_path.waypoints", errCodeInvalid, "can't be used with a preset")
+		}
+		if g.Basis != "" {
+			errs.add("glide_path.basis", errCodeInvalid, "is set by the preset")
+		}
+		if len(g.GrowthWeights) == 0 {
+			errs.add("glide_path.growth_weights", errCodeRequired, "is required with a preset")
+		} else {
+			s.validateWeights(errs, "glide_path.growth_weights", g.GrowthWeights)
+		}
+		if len(g.DefensiveWeights) == 0 {
+			errs.add("glide_path.defensive_weights", errCodeRequired, "is required with a preset")
+		} else {
+			s.validateWeights(errs, "glide_path.defensive_weights", g.DefensiveWeights)
+		}
+		return
+	}
+
+	switch g.Basis {
+	case "", ageBasis, yearsToRetirementBasis:
+	default:
+		errs.add("glide_path.basis", errCodeInvalid, "must be %s or %s, got %q", ageBasis, yearsToRetirementBasis, g.Basis)
+	}
+	seenAt := map[float64]bool{}
+	for i, waypoint := range g.Waypoints {
+		prefix := fmt.Sprintf("glide_path.waypoints[%d].", i)
+		if seenAt[waypoint.At] {
+			errs.add(prefix+"at", errCodeInvalid, "must be unique, %v is used more than once", waypoint.At)
+		}
+		seenAt[waypoint.At] = true
+		s.validateWeights(errs, prefix+"weights", waypoint.Weights)
+	}
+}
+
+// validateFees checks expense ratios are for asset classes in the portfolio,
+// and the advisory fee is flat or tiered
+// Receiver: SimulationData
+// Params: errs *validationErrors
+// Returns: None
+func (s *SimulationData) validateFees(errs *validationErrors) {
+	f := s.Fees
+	for _, assetClassId := range sortedWeightKeys(f.ExpenseRatios) {
+		field := "fees.expense_ratios." + assetClassId
+		errs.checkPercentage(field, f.ExpenseRatios[assetClassId])
+		if _, ok := s.SelectedPortfolioWeights[assetClassId]; !ok {
+			errs.add(field, errCodeUnknownAsset, "%s is not in selected_portfolio_weights", assetClassId)
+		}
+	}
+
+	errs.checkPercentage("fees.advisory_fee", f.AdvisoryFee)
+	if f.AdvisoryFee != 0 && len(f.AdvisoryTiers) > 0 {
+		errs.add("fees.advisory_tiers", errCodeInvalid, "can't be used with advisory_fee")
+	}
+	for i, tier := range f.AdvisoryTiers {
+		prefix := fmt.Sprintf("fees.advisory_tiers[%d].", i)
+		errs.checkNonNegative(prefix+"threshold", tier.Threshold)
+		if i > 0 && tier.Threshold <= f.AdvisoryTiers[i-1].Threshold {
+			errs.add(prefix+"threshold", errCodeInvalid, "must be greater than the previous tier's, got %v", tier.Threshold)
+		}
+		errs.checkPercentage(prefix+"rate", tier.Rate)
+	}
+}
+
+// validateProperties checks each property's id, value, appreciation, costs and
+// dates
+// Receiver: SimulationData
+// Params: errs *validationErrors
+// Returns: None
+func (s *SimulationData) validateProperties(errs *validationErrors) {
+	seenIds := map[string]bool{}
+	for i, property := range s.Properties {
+		prefix := fmt.Sprintf("properties[%d].", i)
+
+		if property.Id == "" {
+			errs.add(prefix+"id", errCodeRequired, "is required")
+		} else if seenIds[property.Id] {
+			errs.add(prefix+"id", errCodeInvalid, "must be unique, %q is used more than once", property.Id)
+		}
+		seenIds[property.Id] = true
+
+		errs.checkNonNegative(prefix+"value", property.Value)
+		if property.Appreciation != nil {
+			validateDistribution(errs, prefix+"appreciation", *property.Appreciation)
+		}
+		errs.checkPercentage(prefix+"carrying_costs", property.CarryingCosts)
+		errs.checkNonNegative(prefix+"rental_income", property.RentalIncome)
+		errs.checkPercentage(prefix+"selling_costs", property.SellingCosts)
+		if property.PurchaseDate < 0 {
+			errs.add(prefix+"purchase_date", errCodeOutOfRange, "must not be negative, got %d", property.PurchaseDate)
+		}
+		if property.SaleDate != 0 && property.SaleDate <= property.PurchaseDate {
+			errs.add(prefix+"sale_date", errCodeOutOfRange, "must be after the purchase date, got %d", property.SaleDate)
+		}
+	}
+}
+
+// validateDebts checks each debt's principal, rate, amortization and extra
+// payments
+// Receiver: SimulationData
+// Params: errs *validationErrors
+// Returns: None
+func (s *SimulationData) validateDebts(errs *validationErrors) {
+	for i, debt := range s.Debts {
+		prefix := fmt.Sprintf("debts[%d].", i)
+
+		errs.checkNonNegative(prefix+"principal", debt.Principal)
+		switch debt.RateType {
+		case "", fixedRate:
+			errs.checkPercentage(prefix+"rate", debt.Rate)
+		case variableRate:
+			if debt.Spread < -100 || debt.Spread > 100 {
+				errs.add(prefix+"spread", errCodeOutOfRange, "must be between -100 and 100, got %v", debt.Spread)
+			}
+		default:
+			errs.add(prefix+"rate_type", errCodeInvalid, "must be %s or %s, got %q", fixedRate, variableRate, debt.RateType)
+		}
+		if debt.AmortizationMonths <= 0 {
+			errs.add(prefix+"amortization_months", errCodeOutOfRange, "must be greater than 0, got %d", debt.AmortizationMonths)
+		}
+		validateSchedule(errs, prefix+"extra_payments", debt.ExtraPayments)
+		if debt.PayOffOnHouseSale && !s.Parameters.IncludeHome {
+			errs.add(prefix+"pay_off_on_house_sale", errCodeMismatch, "the house isn't included in the simulation")
+		}
+		if debt.Property != "" {
+			if s.propertyIndex(debt.Property) < 0 {
+				errs.add(prefix+"property", errCodeMismatch, "there is no property %q", debt.Property)
+			}
+			if debt.PayOffOnHouseSale {
+				errs.add(prefix+"pay_off_on_house_sale", errCodeInvalid, "can't be used with a property")
+			}
+		}
+	}
+}
+
+// validateSpendingPolicy checks the spending policy's type and parameters
+// Receiver: SimulationData
+// Params: errs *validationErrors
+// Returns: None
+func (s *SimulationData) validateSpendingPolicy(errs *validationErrors) {
+	p := s.SpendingPolicy
+	if p.isFixed() {
+		return
+	}
+
+	switch p.Type {
+	case "guardrails", "constant_percentage", "floor_ceiling":
+		if p.WithdrawalRate <= 0 || p.WithdrawalRate > 100 {
+			errs.add("spending_policy.withdrawal_rate", errCodeOutOfRange, "must be greater than 0 and at most 100, got %v", p.WithdrawalRate)
+		}
+	case "vpw":
+		if p.EndAge != 0 && (p.EndAge <= s.primaryAge() || p.EndAge >= len(mortalityTable)) {
+			errs.add("spending_policy.end_age", errCodeOutOfRange, "must be an age between %d and %d, got %d", s.primaryAge()+1, len(mortalityTable)-1, p.EndAge)
+		}
+		if p.ExpectedReturn <= -100 {
+			errs.add("spending_policy.expected_return", errCodeOutOfRange, "must be greater than -100, got %v", p.ExpectedReturn)
+		}
+	default:
+		errs.add("spending_policy.type", errCodeInvalid, "must be one of %s, got %q", strings.Join(spendingPolicyTypes, ", "), p.Type)
+	}
+
+	errs.checkPercentage("spending_policy.upper_guardrail", p.UpperGuardrail)
+	errs.checkPercentage("spending_policy.lower_guardrail", p.LowerGuardrail)
+	errs.checkPercentage("spending_policy.adjustment", p.Adjustment)
+	errs.checkPercentage("spending_policy.floor", p.Floor)
+	errs.checkNonNegative("spending_policy.ceiling", p.Ceiling)
+	if p.Type == "floor_ceiling" {
+		floor, ceiling := orDefault(p.Floor, 90), orDefault(p.Ceiling, 120)
+		if ceiling < floor {
+			errs.add("spending_policy.ceiling", errCodeInvalid, "must be at least the floor (%v), got %v", floor, ceiling)
+		}
+	}
+}
+
+// validateTax checks the tax jurisdiction or bracket schedules
+// Receiver: SimulationData
+// Params: errs *validationErrors
+// Returns: None
+func (s *SimulationData) validateTax(errs *validationErrors) {
+	t := s.Tax
+	errs.checkPercentage("tax.male_income_share", t.MaleIncomeShare)
+
+	if t.Jurisdiction != "" {
+		if _, ok := builtInJurisdictions[t.Jurisdiction]; !ok {
+			errs.add("tax.jurisdiction", errCodeInvalid, "unknown jurisdiction %q", t.Jurisdiction)
+		}
+		if len(t.Schedules) > 0 {
+			errs.add("tax.schedules", errCodeInvalid, "can't be used with a jurisdiction")
+		}
+		return
+	}
+
+	for i, schedule := range t.Schedules {
+		prefix := fmt.Sprintf("tax.schedules[%d].", i)
+		if len(schedule.Brackets) == 0 {
+			errs.add(prefix+"brackets", errCodeRequired, "at least one bracket is required")
+		}
+		for j, bracket := range schedule.Brackets {
+			bracketPrefix := fmt.Sprintf("%sbrackets[%d].", prefix, j)
+			errs.checkNonNegative(bracketPrefix+"threshold", bracket.Threshold)
+			if j > 0 && bracket.Threshold <= schedule.Brackets[j-1].Threshold {
+				errs.add(bracketPrefix+"threshold", errCodeInvalid, "must be greater than the previous bracket's, got %v", bracket.Threshold)
+			}
+			errs.checkPercentage(bracketPrefix+"rate", bracket.Rate)
+		}
+		for _, incomeType := range sortedWeightKeys(schedule.Inclusion) {
+			field := prefix + "inclusion." + incomeType
+			if !(incomeType == "employment" || incomeType == "pension" || incomeType == "withdrawal") {
+				errs.add(field, errCodeInvalid, "must be one of employment, pension or withdrawal")
+			}
+			errs.checkPercentage(field, schedule.Inclusion[incomeType])
+		}
+	}
+}
+
+// validateIncomeStreams checks each income stream's owner, ages and rates
+// Receiver: SimulationData
+// Params: errs *validationErrors
+// Returns: None
+func (s *SimulationData) validateIncomeStreams(errs *validationErrors) {
+	p := s.Parameters
+	for i, stream := range s.IncomeStreams {
+		prefix := fmt.Sprintf("income_streams[%d].", i)
+
+		switch stream.Owner {
+		case "male":
+			if !(p.Married || p.Male) {
+				errs.add(prefix+"owner", errCodeMismatch, "there is no male in the simulation")
+			}
+		case "female":
+			if !(p.Married || !p.Male) {
+				errs.add(prefix+"owner", errCodeMismatch, "there is no female in the simulation")
+			}
+		default:
+			errs.add(prefix+"owner", errCodeInvalid, "must be one of male or female, got %q", stream.Owner)
+		}
+
+		errs.checkNonNegative(prefix+"amount", stream.Amount)
+		errs.checkAge(prefix+"start_age", stream.StartAge, false)
+		if stream.EndAge != 0 && stream.EndAge <= stream.StartAge {
+			errs.add(prefix+"end_age", errCodeOutOfRange, "must be after the start age of %d, got %d", stream.StartAge, stream.EndAge)
+		}
+		errs.checkPercentage(prefix+"indexation", stream.Indexation)
+		errs.checkPercentage(prefix+"survivor_percentage", stream.SurvivorPercentage)
+		errs.checkNonNegative(prefix+"clawback.threshold", stream.Clawback.Threshold)
+		errs.checkPercentage(prefix+"clawback.rate", stream.Clawback.Rate)
+
+		switch stream.Type {
+		case "", governmentStream:
+		case definedBenefitStream:
+			errs.checkNonNegative(prefix+"bridge_amount", stream.BridgeAmount)
+			errs.checkAge(prefix+"bridge_end_age", stream.BridgeEndAge, stream.BridgeAmount > 0)
+		case annuityStream:
+			if stream.Premium <= 0 {
+				errs.add(prefix+"premium", errCodeOutOfRange, "must be greater than 0, got %v", stream.Premium)
+			}
+			if stream.PayoutRate <= 0 || stream.PayoutRate > 100 {
+				errs.add(prefix+"payout_rate", errCodeOutOfRange, "must be greater than 0 and at most 100, got %v", stream.PayoutRate)
+			}
+		default:
+			errs.add(prefix+"type", errCodeInvalid, "must be one of government, defined_benefit or annuity, got %q", stream.Type)
+		}
+	}
+}
+
+// sortedKeys returns the keys of a distribution map in alphabetical order, so
+// errors are reported in a stable order.
+// Params: m map[string]Distribution
+// Returns: []string
+func sortedKeys(m map[string]Distribution) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// sortedWeightKeys returns the keys of a map of weights (or percentages) in
+// alphabetical order, so errors are reported in a stable order.
+// Params: m map[string]float64
+// Returns: []string
+func sortedWeightKeys(m map[string]float64) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,284 @@
+package simulation
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func validSimulationData() *SimulationData {
+	return &SimulationData{
+		NumberOfTrials:        10,
+		CholeskyDecomposition: []float64{0.0094794922, 0, 0, -7.36e-05, 0.0055677999, 0, 0.0050681903, -0.0004821709, 0.013367741},
+		Inflation:             InflationDistribution{Distribution: Distribution{Mean: 0.00046346514957523, StdDev: 0.00024792742828969}},
+		RealEstate:            Distribution{Mean: 0.0029064094738571, StdDev: 0.014660011854061},
+		AssetPerformanceData: map[string]Distribution{
+			"INTL-BOND":      Distribution{Mean: 0.0003, StdDev: 0.0002},
+			"US-REALESTATE":  Distribution{Mean: 0.0004, StdDev: 0.00025},
+			"CDN-REALESTATE": Distribution{Mean: 0.0005, StdDev: 0.00021},
+		},
+		Parameters: Parameters{Male: true, Married: true, Retired: false, MaleAge: 29, RetirementAgeMale: 62, FemaleAge: 30, RetirementAgeFemale: 35, ExpensesMultiplier: 1.6, FractionSingleIncome: 65, StartingAssets: 125000, Income: 120000, CurrentTax: 35, SalaryIncrease: 3, IncomeInflationIndex: 20, ExpensesInflationIndex: 100, RetirementIncome: 12000, RetirementExpenses: 80, RetirementTax: 25, LifeInsurance: 250000, IncludeHome: true, HomeValue: 550000, SellHouseIn: 25, NewHomeRelVal: 65},
+		Expenses: []Expense{
+			Expense{Amount: 100, Frequency: "weekly", OneTimeOn: 0, Ends: 0},
+			Expense{Amount: 300, Frequency: "monthly", OneTimeOn: 0, Ends: 0},
+			Expense{Amount: 5000, Frequency: "annual", OneTimeOn: 0, Ends: 0},
+			Expense{Amount: 25000, Frequency: "onetime", OneTimeOn: 1409551199, Ends: 0},
+		},
+		SelectedPortfolioWeights: map[string]float64{"INTL-BOND": 0.65, "US-REALESTATE": 0.3, "CDN-REALESTATE": 0.05},
+	}
+}
+
+func hasValidationError(errs []ValidationError, field, code string) bool {
+	for _, e := range errs {
+		if e.Field == field && e.Code == code {
+			return true
+		}
+	}
+	return false
+}
+
+func TestValidateAcceptsValidData(t *testing.T) {
+	errs := validSimulationData().Validate()
+	if len(errs) != 0 {
+		t.Error("Expected no errors, got", errs)
+	}
+}
+
+func TestValidateAges(t *testing.T) {
+	s := validSimulationData()
+	s.Parameters.MaleAge = 121
+	s.Parameters.FemaleAge = 0
+
+	errs := s.Validate()
+	if !hasValidationError(errs, "simulation_parameters.male_age", errCodeOutOfRange) {
+		t.Error("Expected male_age out of range, got", errs)
+	}
+	if !hasValidationError(errs, "simulation_parameters.female_age", errCodeRequired) {
+		t.Error("Expected female_age required, got", errs)
+	}
+}
+
+func TestValidatePercentages(t *testing.T) {
+	s := validSimulationData()
+	s.Parameters.CurrentTax = 101
+	s.Parameters.NewHomeRelVal = -5
+
+	errs := s.Validate()
+	if !hasValidationError(errs, "simulation_parameters.current_tax", errCodeOutOfRange) {
+		t.Error("Expected current_tax out of range, got", errs)
+	}
+	if !hasValidationError(errs, "simulation_parameters.new_home_relative_value", errCodeOutOfRange) {
+		t.Error("Expected new_home_relative_value out of range, got", errs)
+	}
+}
+
+func TestValidatePortfolio(t *testing.T) {
+	s := validSimulationData()
+	s.SelectedPortfolioWeights = map[string]float64{"INTL-BOND": 0.65, "MISSING": 0.3}
+	s.CholeskyDecomposition = s.CholeskyDecomposition[0:8]
+
+	errs := s.Validate()
+	if !hasValidationError(errs, "selected_portfolio_weights", errCodeInvalid) {
+		t.Error("Expected weights to not sum to 1, got", errs)
+	}
+	if !hasValidationError(errs, "selected_portfolio_weights.MISSING", errCodeUnknownAsset) {
+		t.Error("Expected unknown asset, got", errs)
+	}
+	if !hasValidationError(errs, "cholesky_decomposition", errCodeInvalid) {
+		t.Error("Expected non-square cholesky, got", errs)
+	}
+
+	s.CholeskyDecomposition = []float64{1, 0, 0, 1}
+	s.SelectedPortfolioWeights = map[string]float64{"INTL-BOND": 1}
+	errs = s.Validate()
+	if !hasValidationError(errs, "cholesky_decomposition", errCodeMismatch) {
+		t.Error("Expected cholesky mismatch, got", errs)
+	}
+}
+
+func TestValidateExpensesAndHouse(t *testing.T) {
+	s := validSimulationData()
+	s.Expenses = append(s.Expenses, Expense{Amount: 10, Frequency: "fortnightly"})
+	s.Parameters.SellHouseIn = 95
+
+	errs := s.Validate()
+	if !hasValidationError(errs, "expenses[4].frequency", errCodeInvalid) {
+		t.Error("Expected invalid frequency, got", errs)
+	}
+	if !hasValidationError(errs, "simulation_parameters.sell_house_in", errCodeOutOfRange) {
+		t.Error("Expected sell_house_in out of range, got", errs)
+	}
+}
+
+func TestValidateAndHandleJsonInputReturns422(t *testing.T) {
+	body := ioutil.NopCloser(strings.NewReader(`{"number_of_trials": 0}`))
+	resp := ValidateAndHandleJsonInput(context.Background(), body, DefaultLimits())
+
+	if resp.StatusCode != http.StatusUnprocessableEntity {
+		t.Error("Expected 422, got", resp.StatusCode)
+	}
+	if _, ok := resp.Response["errors"].([]ValidationError); !ok {
+		t.Error("Expected a list of errors, got", resp.Response["errors"])
+	}
+}
+
+func TestValidateHorizon(t *testing.T) {
+	s := validSimulationData()
+	s.Horizon = Horizon{Type: "age", Value: 25}
+
+	errs := s.Validate()
+	if !hasValidationError(errs, "horizon.value", errCodeOutOfRange) {
+		t.Error("Expected horizon age out of range, got", errs)
+	}
+
+	s.Horizon = Horizon{Type: "decades", Value: 3}
+	errs = s.Validate()
+	if !hasValidationError(errs, "horizon.type", errCodeInvalid) {
+		t.Error("Expected invalid horizon type, got", errs)
+	}
+
+	// Both at the end of the mortality table leaves nothing to simulate
+	s = validSimulationData()
+	s.Parameters.MaleAge = 120
+	s.Parameters.FemaleAge = 120
+	s.Parameters.IncludeHome = false
+	errs = s.Validate()
+	if !hasValidationError(errs, "horizon", errCodeOutOfRange) {
+		t.Error("Expected a horizon of no months to be invalid, got", errs)
+	}
+}
+
+func TestValidateAccounts(t *testing.T) {
+	s := validSimulationData()
+	s.Accounts = []Account{
+		Account{Id: "rrsp", Balance: 1000, TaxTreatment: taxDeferred, PortfolioWeights: map[string]float64{"INTL-BOND": 1}},
+		Account{Id: "rrsp", Balance: -1, TaxTreatment: "offshore"},
+		Account{Id: "", TaxTreatment: taxFree, PortfolioWeights: map[string]float64{"GOLD": 0.5}, Contributions: []Expense{Expense{Amount: 100, Frequency: "daily"}}},
+	}
+
+	errs := s.Validate()
+	if hasValidationError(errs, "accounts[0].id", errCodeInvalid) || len(errs) != 8 {
+		t.Error("Expected 8 account errors, got", errs)
+	}
+	for _, expected := range []struct{ field, code string }{
+		{"simulation_parameters.starting_assets", errCodeInvalid},
+		{"accounts[1].id", errCodeInvalid},
+		{"accounts[1].balance", errCodeOutOfRange},
+		{"accounts[1].tax_treatment", errCodeInvalid},
+		{"accounts[2].id", errCodeRequired},
+		{"accounts[2].portfolio_weights.GOLD", errCodeUnknownAsset},
+		{"accounts[2].portfolio_weights", errCodeInvalid},
+		{"accounts[2].contributions[0].frequency", errCodeInvalid},
+	} {
+		if !hasValidationError(errs, expected.field, expected.code) {
+			t.Error("Expected", expected.code, "error for", expected.field)
+		}
+	}
+}
+
+func TestValidateWithdrawalStrategy(t *testing.T) {
+	s := validSimulationData()
+	s.WithdrawalStrategy = WithdrawalStrategy{Type: "biggest_first", BracketCeiling: -1}
+
+	errs := s.Validate()
+	if !hasValidationError(errs, "withdrawal_strategy.type", errCodeInvalid) || !hasValidationError(errs, "withdrawal_strategy.bracket_ceiling", errCodeOutOfRange) {
+		t.Error("Expected withdrawal strategy errors, got", errs)
+	}
+}
+
+func TestValidateSpendingPolicy(t *testing.T) {
+	s := validSimulationData()
+	s.SpendingPolicy = SpendingPolicy{Type: "guardrails", WithdrawalRate: 0, Adjustment: 150}
+
+	errs := s.Validate()
+	if !hasValidationError(errs, "spending_policy.withdrawal_rate", errCodeOutOfRange) || !hasValidationError(errs, "spending_policy.adjustment", errCodeOutOfRange) {
+		t.Error("Expected spending policy errors, got", errs)
+	}
+
+	s.SpendingPolicy = SpendingPolicy{Type: "vpw", EndAge: 20}
+	if !hasValidationError(s.Validate(), "spending_policy.end_age", errCodeOutOfRange) {
+		t.Error("Expected an end age error")
+	}
+
+	s.SpendingPolicy = SpendingPolicy{Type: "floor_ceiling", WithdrawalRate: 4, Floor: 95, Ceiling: 80}
+	if !hasValidationError(s.Validate(), "spending_policy.ceiling", errCodeInvalid) {
+		t.Error("Expected a ceiling below the floor to be invalid")
+	}
+
+	s.SpendingPolicy = SpendingPolicy{Type: "yolo"}
+	if !hasValidationError(s.Validate(), "spending_policy.type", errCodeInvalid) {
+		t.Error("Expected a type error")
+	}
+}
+
+func TestValidateTax(t *testing.T) {
+	s := validSimulationData()
+	s.Tax = TaxSettings{Jurisdiction: "Narnia"}
+	if !hasValidationError(s.Validate(), "tax.jurisdiction", errCodeInvalid) {
+		t.Error("Expected a jurisdiction error")
+	}
+
+	s.Tax = TaxSettings{Schedules: []TaxSchedule{
+		TaxSchedule{Inclusion: map[string]float64{"dividends": 50}, Brackets: []TaxBracket{
+			TaxBracket{Threshold: 1000, Rate: 10},
+			TaxBracket{Threshold: 500, Rate: 120},
+		}},
+		TaxSchedule{},
+	}}
+	errs := s.Validate()
+	for _, expected := range []struct{ field, code string }{
+		{"tax.schedules[0].inclusion.dividends", errCodeInvalid},
+		{"tax.schedules[0].brackets[1].threshold", errCodeInvalid},
+		{"tax.schedules[0].brackets[1].rate", errCodeOutOfRange},
+		{"tax.schedules[1].brackets", errCodeRequired},
+	} {
+		if !hasValidationError(errs, expected.field, expected.code) {
+			t.Error("Expected", expected.code, "error for", expected.field, "got", errs)
+		}
+	}
+}
+
+func TestValidateIncomeStreams(t *testing.T) {
+	s := validSimulationData()
+	s.Parameters.Married = false
+	s.IncomeStreams = []IncomeStream{
+		IncomeStream{Owner: "female", Amount: 1000, StartAge: 65},
+		IncomeStream{Owner: "male", Amount: 1000, StartAge: 70, EndAge: 65, SurvivorPercentage: 150},
+		IncomeStream{Owner: "dog"},
+	}
+
+	errs := s.Validate()
+	for _, expected := range []struct{ field, code string }{
+		{"income_streams[0].owner", errCodeMismatch},
+		{"income_streams[1].end_age", errCodeOutOfRange},
+		{"income_streams[1].survivor_percentage", errCodeOutOfRange},
+		{"income_streams[2].owner", errCodeInvalid},
+	} {
+		if !hasValidationError(errs, expected.field, expected.code) {
+			t.Error("Expected", expected.code, "error for", expected.field, "got", errs)
+		}
+	}
+}
+
+func TestValidatePensionsAndAnnuities(t *testing.T) {
+	s := validSimulationData()
+	s.IncomeStreams = []IncomeStream{
+		IncomeStream{Type: definedBenefitStream, Owner: "male", StartAge: 60, BridgeAmount: 5000},
+		IncomeStream{Type: annuityStream, Owner: "female", StartAge: 65, PayoutRate: 150},
+		IncomeStream{Type: "lottery", Owner: "male"},
+	}
+
+	errs := s.Validate()
+	for _, expected := range []struct{ field, code string }{
+		{"income_streams[0].bridge_end_age", errCodeRequired},
+		{"income_streams[1].premium", errCodeOutOfRange},
+		{"income_streams[1].payout_rate", errCodeOutOfRange},
+		{"income_streams[2].type", errCodeInvalid},
+	} {
+		if !hasValidationError(errs, expected.field, expected.code) {
+			t.Error("Expected", expected.code, "error for", expected.field, "got", errs)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package simulation
+
+import "math"
+
+// WithdrawalStrategy picks the order shortfalls are drawn from the accounts in
+type WithdrawalStrategy struct {
+	// "proportional" (default), "taxable_first", "tax_deferred_first" or
+	// "bracket_filling"
+	Type string `json:"type"`
+
+	// For bracket_filling - annual taxable income (in today's dollars) to fill
+	// with tax-deferred withdrawals before drawing on other accounts.
+	BracketCeiling float64 `json:"bracket_ceiling"`
+}
+
+// name returns the strategy's type, or the default if none was chosen
+// Receiver: WithdrawalStrategy
+// Params: None
+// Returns: string
+func (w WithdrawalStrategy) name() string {
+	if w.Type == "" {
+		return "proportional"
+	}
+	return w.Type
+}
+
+// withdrawal is the state a withdrawal strategy works on - the accounts, and
+// what has been drawn from each this time step.
+type withdrawal struct {
+	accounts       []Account
+	balances       []float64 // current balances, updated in place
+	draws          []float64 // gross amount drawn from each account this time step
+	deferredDraws  float64   // total drawn from tax-deferred accounts this time step
+	taxRate        float64   // 0 - 1, applied to tax-deferred withdrawals
+	depositAccount int       // account any deficit is taken from
+	bracketCeiling float64
+	step           *simulationTimeStep
+}
+
+// withdrawalStrategy covers an after-tax shortfall from the accounts
+type withdrawalStrategy func(w *withdrawal, shortfall float64)
+
+// withdrawalStrategies are the strategies that can be chosen by name
+var withdrawalStrategies = map[string]withdrawalStrategy{
+	"proportional":       withdrawProportionally,
+	"taxable_first":      withdrawTaxableFirst,
+	"tax_deferred_first": withdrawInOrder(taxDeferred, taxable, taxFree),
+	"bracket_filling":    withdrawFillingBracket,
+}
+
+var withdrawTaxableFirst = withdrawInOrder(taxable, taxFree, taxDeferred)
+
+// take draws a gross amount from an account
+// Receiver: *withdrawal
+// Params: account int -- index of the account
+// Params: amount float64 -- before tax
+// Returns: None
+func (w *withdrawal) take(account int, amount float64) {
+	w.balances[account] -= amount
+	w.draws[account] += amount
+	if w.accounts[account].isTaxDeferred() {
+		w.deferredDraws += amount
+	}
+}
+
+// takeAfterTax draws up to an after-tax amount from an account, grossing it up
+// to cover tax if the account is tax-deferred.
+// Receiver: *withdrawal
+// Params: account int -- index of the account
+// Params: amount float64 -- after tax
+// Returns: float64 -- after-tax amount actually drawn
+func (w *withdrawal) takeAfterTax(account int, amount float64) float64 {
+	fraction := afterTaxFraction(&w.accounts[account], w.taxRate)
+	if w.balances[account] <= 0 || fraction <= 0 {
+		return 0
+	}
+	available := w.balances[account] * fraction
+	if amount >= available {
+		w.take(account, w.balances[account])
+		return available
+	}
+	w.take(account, amount/fraction)
+	return amount
+}
+
+// coverDeficit takes whatever couldn't be withdrawn from the deposit account,
+// leaving it negative. This is borrowing rather than a withdrawal, so isn't
+// taxed.
+// Receiver: *withdrawal
+// Params: deficit float64
+// Returns: None
+func (w *withdrawal) coverDeficit(deficit float64) {
+	if deficit > 0 {
+		w.balances[w.depositAccount] -= deficit
+		w.draws[w.depositAccount] += deficit
+	}
+}
+
+// withdrawProportionally covers a shortfall by withdrawing from every account
+// with money in it, in proportion to its balance. Withdrawals from tax-deferred
+// accounts are grossed up to cover the tax on them.
+// Params: w *withdrawal
+// Params: shortfall float64 -- after-tax amount needed
+// Returns: None
+func withdrawProportionally(w *withdrawal, shortfall float64) {
+	// After-tax value of everything that can be withdrawn
+	available := 0.0
+	for i, balance := range w.balances {
+		if balance > 0 {
+			available += balance * afterTaxFraction(&w.accounts[i], w.taxRate)
+		}
+	}
+
+	if shortfall >= available {
+		for i, balance := range w.balances {
+			if balance > 0 {
+				w.take(i, balance)
+			}
+		}
+		w.coverDeficit(shortfall - available)
+		return
+	}
+
+	fraction := shortfall / available
+	for i, balance := range w.balances {
+		if balance > 0 {
+			w.take(i, balance*fraction)
+		}
+	}
+}
+
+// withdrawInOrder returns a strategy that empties accounts one tax treatment at
+// a time, in the order given. Accounts with the same treatment are drawn in the
+// order they were provided.
+// Params: taxTreatments ...string
+// Returns: withdrawalStrategy
+func withdrawInOrder(taxTreatments ...string) withdrawalStrategy {
+	return func(w *withdrawal, shortfall float64) {
+		for _, taxTreatment := range taxTreatments {
+			for i := range w.accounts {
+				if shortfall <= 0 {
+					return
+				}
+				if w.accounts[i].TaxTreatment == taxTreatment {
+					shortfall -= w.takeAfterTax(i, shortfall)
+				}
+			}
+		}
+		w.coverDeficit(shortfall)
+	}
+}
+
+// withdrawFillingBracket draws from tax-deferred accounts until taxable income
+// for the month reaches the bracket ceiling, then from taxable and tax-free
+// accounts, and only then from tax-deferred accounts above the ceiling.
+// Params: w *withdrawal
+// Params: shortfall float64 -- after-tax amount needed
+// Returns: None
+func withdrawFillingBracket(w *withdrawal, shortfall float64) {
+	if w.taxRate < 1 {
+		room := w.bracketCeiling/12*w.step.inflationFactor - w.step.taxableIncome
+		for i := range w.accounts {
+			if room <= 0 || shortfall <= 0 {
+				break
+			}
+			if !w.accounts[i].isTaxDeferred() {
+				continue
+			}
+			drawn := w.takeAfterTax(i, math.Min(shortfall, room*(1-w.taxRate)))
+			shortfall -= drawn
+			room -= drawn / (1 - w.taxRate)
+		}
+	}
+	withdrawTaxableFirst(w, shortfall)
+}
+
+// afterTaxFraction returns how much of a withdrawal from an account is left
+// after tax
+// Params: account *Account
+// Params: taxRate float64 -- 0 - 1
+// Returns: float64
+func afterTaxFraction(account *Account, taxRate float64) float64 {
+	if account.isTaxDeferred() {
+		return 1 - taxRate
+	}
+	return 1
+}
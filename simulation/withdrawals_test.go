@@ -0,0 +1,74 @@
+package simulation
+
+import "testing"
+
+func testWithdrawal(balances ...float64) *withdrawal {
+	return &withdrawal{
+		accounts: []Account{
+			Account{Id: "cash", TaxTreatment: taxable},
+			Account{Id: "rrsp", TaxTreatment: taxDeferred},
+			Account{Id: "tfsa", TaxTreatment: taxFree},
+		},
+		balances: balances,
+		draws:    make([]float64, len(balances)),
+		taxRate:  0.5,
+		step:     &simulationTimeStep{inflationFactor: 1},
+	}
+}
+
+func TestWithdrawProportionallyGrossesUpTaxDeferred(t *testing.T) {
+	w := testWithdrawal(1000, 1000, 0)
+
+	// 1500 after tax is available, so take a third of each account
+	withdrawProportionally(w, 500)
+	if !closeTo(w.balances[0], 2000.0/3, 1e-9) || !closeTo(w.balances[1], 2000.0/3, 1e-9) {
+		t.Error("Expected a third withdrawn from each account, got", w.balances)
+	}
+
+	// More than is available - everything is withdrawn and the deficit left
+	// in the deposit account
+	withdrawProportionally(w, 2000)
+	if !closeTo(w.balances[0], -1000, 1e-9) || w.balances[1] != 0 {
+		t.Error("Expected accounts drained and deficit of 1000 in cash, got", w.balances)
+	}
+	if !closeTo(w.draws[0], 1000+1000.0/3+2000.0/3, 1e-9) {
+		t.Error("Expected the deficit to count as a draw, got", w.draws)
+	}
+}
+
+func TestCoverDeficitIsNotTaxed(t *testing.T) {
+	w := testWithdrawal(0, 0, 0)
+	w.depositAccount = 1
+	w.coverDeficit(500)
+	if w.balances[1] != -500 || w.draws[1] != 500 {
+		t.Error("Expected the deficit left in the rrsp, got", w.balances, w.draws)
+	}
+	if w.deferredDraws != 0 {
+		t.Error("Expected the deficit not to count as a tax-deferred withdrawal, got", w.deferredDraws)
+	}
+}
+
+func TestWithdrawInOrder(t *testing.T) {
+	w := testWithdrawal(100, 1000, 1000)
+	withdrawalStrategies["taxable_first"](w, 300)
+	if w.draws[0] != 100 || w.draws[1] != 0 || w.draws[2] != 200 {
+		t.Error("Expected cash then tfsa to be drawn, got", w.draws)
+	}
+
+	w = testWithdrawal(100, 1000, 1000)
+	withdrawalStrategies["tax_deferred_first"](w, 300)
+	if w.draws[0] != 0 || w.draws[1] != 600 || w.draws[2] != 0 {
+		t.Error("Expected grossed up rrsp draw of 600, got", w.draws)
+	}
+}
+
+func TestWithdrawFillingBracket(t *testing.T) {
+	w := testWithdrawal(1000, 1000, 1000)
+	w.bracketCeiling = 12 * 300
+	w.step.taxableIncome = 100 // leaves 200 of room
+
+	withdrawFillingBracket(w, 400)
+	if w.draws[1] != 200 || w.draws[0] != 300 || w.draws[2] != 0 {
+		t.Error("Expected 200 from rrsp then 300 from cash, got", w.draws)
+	}
+}